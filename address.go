@@ -0,0 +1,247 @@
+package godis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultResolveInterval = 30 * time.Second
+
+// addressList dials the first reachable address of an ordered list of seed
+// addresses, starting from the endpoint of the last connection established.
+// The host names of the seeds are resolved by the list itself, once before the
+// first dial and then periodically in the background while a pool uses the
+// list, so that new IPs are picked up by the next connections without waiting
+// for DNS. Behind a proxy the seeds are dialed as they are.
+type addressList struct {
+	seeds    []string
+	interval time.Duration
+	timeout  time.Duration
+	// Whether the hosts are left to the proxy to resolve.
+	noResolve bool
+	onChange  func(from, to string)
+	lookup    func(ctx context.Context, host string) ([]string, error)
+
+	mutex    sync.Mutex
+	resolved map[string][]string
+	// The endpoint of the last connection established.
+	active endpoint
+	// The number of pools using the list, the background resolution stops
+	// when it drops to 0.
+	users int
+	done  chan struct{}
+}
+
+func newAddressList(config *ConnectionConfig) *addressList {
+	interval := config.ResolveInterval
+	if interval == 0 {
+		interval = defaultResolveInterval
+	}
+	return &addressList{
+		seeds:     config.Addresses,
+		interval:  interval,
+		timeout:   config.DialTimeOut,
+		noResolve: config.Proxy != "",
+		onChange:  config.OnAddressChange,
+		lookup:    net.DefaultResolver.LookupHost,
+	}
+}
+
+// initAddresses creates the address list shared by the connections created
+// from the config and starts resolving it in the background. A pool calling
+// it must call closeAddresses when it is closed.
+func (c *ConnectionConfig) initAddresses() {
+	if len(c.Addresses) == 0 {
+		return
+	}
+	if c.addrs == nil {
+		c.addrs = newAddressList(c)
+	}
+	c.addrs.start()
+}
+
+func (c *ConnectionConfig) closeAddresses() {
+	if c.addrs != nil {
+		c.addrs.stop()
+	}
+}
+
+// ActiveAddress returns the address of Addresses that the last connection was
+// established to, or Address if Addresses is empty.
+func (c *ConnectionConfig) ActiveAddress() string {
+	if c.addrs == nil {
+		return c.Address
+	}
+	return c.addrs.activeSeed()
+}
+
+func (c *ConnectionConfig) addresses() *addressList {
+	if c.addrs == nil {
+		return newAddressList(c)
+	}
+	return c.addrs
+}
+
+// address describes the addresses of the config in errors.
+func (c *ConnectionConfig) address() string {
+	if len(c.Addresses) == 0 {
+		return c.Address
+	}
+	return strings.Join(c.Addresses, ",")
+}
+
+type endpoint struct {
+	// The seed address the endpoint comes from.
+	seed string
+	// The address to dial, the seed with its host resolved.
+	addr string
+}
+
+// dial tries the endpoints, starting from the active one, and returns the
+// first connection established together with its seed.
+func (l *addressList) dial(dial func(network, addr string) (net.Conn, error)) (string, net.Conn, error) {
+	var errs []string
+	for _, ep := range l.endpoints() {
+		con, err := dial("tcp", ep.addr)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		l.setActive(ep)
+		return ep.seed, con, nil
+	}
+	return "", nil, errors.Errorf("no reachable address: %v", errs)
+}
+
+// endpoints returns the endpoints in the order of the seeds, the active one
+// first.
+func (l *addressList) endpoints() []endpoint {
+	l.mutex.Lock()
+	resolved := l.resolved
+	l.mutex.Unlock()
+	// Only the first dial, or every dial with a negative interval, waits for
+	// the resolution.
+	if resolved == nil || l.interval < 0 {
+		resolved = l.resolve()
+	}
+
+	l.mutex.Lock()
+	active := l.active
+	l.mutex.Unlock()
+	var eps []endpoint
+	for _, seed := range l.seeds {
+		for _, addr := range resolved[seed] {
+			ep := endpoint{seed: seed, addr: addr}
+			if ep == active {
+				eps = append([]endpoint{ep}, eps...)
+				continue
+			}
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+// resolve resolves the host of every seed and returns the new addresses. A
+// seed that fails to resolve keeps its previous addresses, or is dialed as is.
+func (l *addressList) resolve() map[string][]string {
+	ctx, cancel := context.WithCancel(context.Background())
+	if l.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+	}
+	defer cancel()
+
+	l.mutex.Lock()
+	previous := l.resolved
+	l.mutex.Unlock()
+
+	resolved := make(map[string][]string, len(l.seeds))
+	for _, seed := range l.seeds {
+		host, port, err := net.SplitHostPort(seed)
+		if err != nil || l.noResolve || net.ParseIP(host) != nil {
+			resolved[seed] = []string{seed}
+			continue
+		}
+		ips, err := l.lookup(ctx, host)
+		if err != nil || len(ips) == 0 {
+			resolved[seed] = previous[seed]
+			if len(resolved[seed]) == 0 {
+				resolved[seed] = []string{seed}
+			}
+			continue
+		}
+		addrs := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, port))
+		}
+		resolved[seed] = addrs
+	}
+
+	l.mutex.Lock()
+	l.resolved = resolved
+	l.mutex.Unlock()
+	return resolved
+}
+
+// start resolves the seeds every interval in the background for one more
+// pool.
+func (l *addressList) start() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.users++
+	if l.users > 1 || l.interval <= 0 {
+		return
+	}
+	done := make(chan struct{})
+	l.done = done
+	go func() {
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.resolve()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the background resolution once no pool uses the list.
+func (l *addressList) stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.users == 0 {
+		return
+	}
+	l.users--
+	if l.users == 0 && l.done != nil {
+		close(l.done)
+		l.done = nil
+	}
+}
+
+// activeSeed returns the seed of the last connection established, empty
+// before the first one.
+func (l *addressList) activeSeed() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.active.seed
+}
+
+func (l *addressList) setActive(ep endpoint) {
+	l.mutex.Lock()
+	from := l.active.seed
+	l.active = ep
+	l.mutex.Unlock()
+
+	if from != ep.seed && l.onChange != nil {
+		l.onChange(from, ep.seed)
+	}
+}
@@ -0,0 +1,132 @@
+package godis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func unreachableAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+func TestAddressFailover(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	dead := unreachableAddress(t)
+
+	var changes [][2]string
+	cli, err := NewClient(&ClientConfig{
+		Addresses: []string{dead, server.Addr()},
+		OnAddressChange: func(from, to string) {
+			changes = append(changes, [2]string{from, to})
+		},
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	_, err = cli.Set(context.Background(), "k", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]string{{"", server.Addr()}}, changes)
+
+	cli2, err := NewClient(&ClientConfig{Addresses: []string{dead}})
+	assert.Nil(t, err)
+	defer cli2.Close()
+	_, err = cli2.Get(context.Background(), "k")
+	assert.NotNil(t, err)
+}
+
+func TestAddressResolve(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2"}
+	var lookupErr error
+	l := newAddressList(&ConnectionConfig{
+		Addresses:       []string{"10.0.0.9:6379", "redis.test:6380"},
+		ResolveInterval: -1,
+	})
+	l.lookup = func(ctx context.Context, host string) ([]string, error) {
+		assert.Equal(t, "redis.test", host)
+		return ips, lookupErr
+	}
+
+	assert.Equal(t, []endpoint{
+		{seed: "10.0.0.9:6379", addr: "10.0.0.9:6379"},
+		{seed: "redis.test:6380", addr: "10.0.0.1:6380"},
+		{seed: "redis.test:6380", addr: "10.0.0.2:6380"},
+	}, l.endpoints())
+
+	ips = []string{"10.0.0.3"}
+	assert.Equal(t, endpoint{seed: "redis.test:6380", addr: "10.0.0.3:6380"}, l.endpoints()[1])
+
+	// A failed lookup keeps the previous addresses
+	lookupErr = errors.New("no such host")
+	assert.Equal(t, endpoint{seed: "redis.test:6380", addr: "10.0.0.3:6380"}, l.endpoints()[1])
+
+	// Dialing starts from the endpoint of the last connection
+	l.setActive(endpoint{seed: "redis.test:6380", addr: "10.0.0.3:6380"})
+	assert.Equal(t, []endpoint{
+		{seed: "redis.test:6380", addr: "10.0.0.3:6380"},
+		{seed: "10.0.0.9:6379", addr: "10.0.0.9:6379"},
+	}, l.endpoints())
+}
+
+func TestAddressBackgroundResolve(t *testing.T) {
+	var mutex sync.Mutex
+	ips := []string{"10.0.0.1"}
+	config := &ConnectionConfig{
+		Addresses:       []string{"redis.test:6379"},
+		ResolveInterval: 5 * time.Millisecond,
+	}
+	config.addrs = newAddressList(config)
+	config.addrs.lookup = func(ctx context.Context, host string) ([]string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return ips, nil
+	}
+	config.initAddresses()
+	assert.Equal(t, "10.0.0.1:6379", config.addrs.endpoints()[0].addr)
+
+	// Dialing doesn't resolve, the new IPs are picked up in the background
+	mutex.Lock()
+	ips = []string{"10.0.0.2"}
+	mutex.Unlock()
+	assert.Equal(t, "10.0.0.1:6379", config.addrs.endpoints()[0].addr)
+	assert.Eventually(t, func() bool {
+		return config.addrs.endpoints()[0].addr == "10.0.0.2:6379"
+	}, time.Second, time.Millisecond)
+
+	// Not resolved anymore once the pool is closed
+	config.closeAddresses()
+	mutex.Lock()
+	ips = []string{"10.0.0.3"}
+	mutex.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "10.0.0.2:6379", config.addrs.endpoints()[0].addr)
+}
+
+func TestActiveAddress(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	dead := unreachableAddress(t)
+
+	config := &ClientConfig{Addresses: []string{dead, server.Addr()}}
+	cli, err := NewClient(config)
+	assert.Nil(t, err)
+	defer cli.Close()
+	assert.Equal(t, "", config.ActiveAddress())
+
+	_, err = cli.Set(context.Background(), "k", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, server.Addr(), config.ActiveAddress())
+
+	config = &ClientConfig{Address: server.Addr()}
+	assert.Equal(t, server.Addr(), config.ActiveAddress())
+}
@@ -0,0 +1,131 @@
+package godis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAutoPipelineWindow    = 100 * time.Microsecond
+	defaultAutoPipelineBatchSize = 100
+)
+
+// autoPipeliner coalesces the commands issued concurrently by different
+// callers into pipelines. A pipeline is sent when it holds batchSize commands
+// or when its first command has waited for window.
+type autoPipeliner struct {
+	client    *client
+	window    time.Duration
+	batchSize int
+	mutex     sync.Mutex
+	queue     []*autoPipelineCall
+	timer     *time.Timer
+}
+
+type autoPipelineCall struct {
+	ctx  context.Context
+	cmd  Command
+	res  interface{}
+	err  error
+	done chan struct{}
+}
+
+func newAutoPipeliner(c *client, window time.Duration, batchSize uint) *autoPipeliner {
+	return &autoPipeliner{client: c, window: window, batchSize: int(batchSize)}
+}
+
+func (a *autoPipeliner) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	call := &autoPipelineCall{ctx: ctx, cmd: cmd, done: make(chan struct{})}
+
+	a.mutex.Lock()
+	a.queue = append(a.queue, call)
+	var full []*autoPipelineCall
+	if len(a.queue) >= a.batchSize {
+		full = a.take()
+	} else if len(a.queue) == 1 {
+		a.timer = time.AfterFunc(a.window, a.flushQueued)
+	}
+	a.mutex.Unlock()
+
+	if full != nil {
+		a.flush(full)
+	}
+	select {
+	case <-call.done:
+		return call.res, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take empties the queue. The caller must hold the mutex.
+func (a *autoPipeliner) take() []*autoPipelineCall {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	calls := a.queue
+	a.queue = nil
+	return calls
+}
+
+func (a *autoPipeliner) flushQueued() {
+	a.mutex.Lock()
+	calls := a.take()
+	a.mutex.Unlock()
+
+	if len(calls) > 0 {
+		a.flush(calls)
+	}
+}
+
+func (a *autoPipeliner) flush(calls []*autoPipelineCall) {
+	live := calls[:0]
+	for _, call := range calls {
+		if err := call.ctx.Err(); err != nil {
+			call.err = err
+			close(call.done)
+			continue
+		}
+		live = append(live, call)
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	b := &commandBatch{Pipeline: &Pipeline{}}
+	for _, call := range live {
+		b.commands = append(b.commands, call.cmd)
+	}
+	ctx, cancel := batchContext(live)
+	defer cancel()
+	_, err := a.client.execWithRetry(ctx, b)
+	for i, call := range live {
+		if err != nil {
+			call.err = err
+		} else {
+			call.res, call.err = b.res[i], b.errs[i]
+		}
+		close(call.done)
+	}
+}
+
+// batchContext returns a context that lives as long as the longest of the
+// callers' deadlines, so that a caller giving up doesn't abort the others.
+func batchContext(calls []*autoPipelineCall) (context.Context, context.CancelFunc) {
+	var latest time.Time
+	for _, call := range calls {
+		dl, ok := call.ctx.Deadline()
+		if !ok {
+			return context.WithCancel(context.Background())
+		}
+		if dl.After(latest) {
+			latest = dl
+		}
+	}
+	return context.WithDeadline(context.Background(), latest)
+}
@@ -0,0 +1,129 @@
+package godis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoPipeline(t *testing.T) {
+	var mutex sync.Mutex
+	requests := 0
+	kv := kvHandler()
+	server := newFakeServer(t, func(args []string) string {
+		mutex.Lock()
+		requests++
+		mutex.Unlock()
+		return kv(args)
+	})
+	cli, err := NewClient(&ClientConfig{
+		Address:               server.Addr(),
+		AutoPipeline:          true,
+		AutoPipelineWindow:    10 * time.Millisecond,
+		AutoPipelineBatchSize: 10,
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			k := "k" + strconv.Itoa(i)
+			ok, err := cli.Set(ctx, k, strconv.Itoa(i))
+			assert.Nil(t, err)
+			assert.True(t, ok)
+		}(i)
+	}
+	wg.Wait()
+	mutex.Lock()
+	assert.Equal(t, 30, requests)
+	mutex.Unlock()
+	// Full batches are sent at once instead of using a connection per command
+	assert.LessOrEqual(t, server.ConNum(), 3)
+
+	// Each caller gets its own result or error
+	var getRes *string
+	var getErr, badErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		getRes, getErr = cli.Get(ctx, "k7")
+	}()
+	go func() {
+		defer wg.Done()
+		_, badErr = cli.GetDel(ctx, "k7")
+	}()
+	wg.Wait()
+	assert.Nil(t, getErr)
+	assert.Equal(t, "7", *getRes)
+	assert.Equal(t, "ERR", badErr.(Error).Type)
+}
+
+func TestAutoPipelineCanceledCaller(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	cli, err := NewClient(&ClientConfig{
+		Address:            server.Addr(),
+		AutoPipeline:       true,
+		AutoPipelineWindow: 20 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cli.Get(ctx, "k")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = cli.Get(ctx, "k")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	r, err := cli.Get(context.Background(), "k")
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+}
+
+func TestAutoPipelineRetryRejectedCommand(t *testing.T) {
+	var mutex sync.Mutex
+	loading := 2
+	kv := kvHandler()
+	server := newFakeServer(t, func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if args[0] == "GET" && loading > 0 {
+			loading--
+			return "-LOADING Redis is loading the dataset in memory\r\n"
+		}
+		return kv(args)
+	})
+	cli, err := NewClient(&ClientConfig{
+		Address:            server.Addr(),
+		AutoPipeline:       true,
+		AutoPipelineWindow: time.Millisecond,
+		Retry:              &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond},
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	ctx := context.Background()
+	_, err = cli.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	r, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *r)
+
+	// The command keeps the error once the attempts are used up
+	mutex.Lock()
+	loading = 3
+	mutex.Unlock()
+	_, err = cli.Get(ctx, "k")
+	assert.Equal(t, "LOADING", err.(Error).Type)
+}
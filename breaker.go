@@ -0,0 +1,169 @@
+package godis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBreakerFailureThreshold    = 5
+	defaultBreakerOpenTimeout         = 5 * time.Second
+	defaultBreakerHalfOpenMaxRequests = 1
+)
+
+type CircuitState int
+
+const (
+	// Requests go through and failures are counted.
+	CircuitClosed CircuitState = iota
+	// Requests fail fast with ErrCircuitOpen.
+	CircuitOpen
+	// A limited number of requests probe whether the node has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitBreakerConfig struct {
+	// The number of consecutive failures that opens the circuit. Default is 5.
+	FailureThreshold uint
+	// How long the circuit stays open before probing the node again. Default is 5 seconds.
+	OpenTimeout time.Duration
+	// The maximum number of concurrent probes while half-open. Default is 1.
+	HalfOpenMaxRequests uint
+	// Called after every state change, e.g. to export metrics. It must not block.
+	OnStateChange func(from, to CircuitState)
+}
+
+func (c *CircuitBreakerConfig) check() {
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if c.OpenTimeout == 0 {
+		c.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if c.HalfOpenMaxRequests == 0 {
+		c.HalfOpenMaxRequests = defaultBreakerHalfOpenMaxRequests
+	}
+}
+
+// circuitBreaker stops sending requests to a node after consecutive failures,
+// so that callers don't wait for the dial timeout while the node is down.
+type circuitBreaker struct {
+	config   *CircuitBreakerConfig
+	mutex    sync.Mutex
+	state    CircuitState
+	failures uint
+	probes   uint
+	openedAt time.Time
+}
+
+func newCircuitBreaker(config *CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{config: config}
+}
+
+// allow reports whether a request may be sent. Every allowed request must be
+// followed by a call to done.
+func (b *circuitBreaker) allow() error {
+	b.mutex.Lock()
+	from := b.state
+	err := b.tryAcquire()
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+	return err
+}
+
+func (b *circuitBreaker) tryAcquire() error {
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		b.probes = 0
+		fallthrough
+	case CircuitHalfOpen:
+		if b.probes >= b.config.HalfOpenMaxRequests {
+			return ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// done records the outcome of a request allowed by allow.
+func (b *circuitBreaker) done(err error) {
+	failed := isNodeFailure(err)
+
+	b.mutex.Lock()
+	from := b.state
+	switch b.state {
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			break
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.open()
+		}
+	case CircuitHalfOpen:
+		var e Error
+		switch {
+		case failed:
+			b.open()
+		case err == nil || errors.As(err, &e):
+			b.state = CircuitClosed
+			b.failures = 0
+		case b.probes > 0:
+			// The probe ended without an answer of the node, e.g. it was
+			// cancelled, so another one may be sent.
+			b.probes--
+		}
+	}
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+}
+
+func (b *circuitBreaker) open() {
+	b.state = CircuitOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+}
+
+func (b *circuitBreaker) notify(from, to CircuitState) {
+	if from != to && b.config.OnStateChange != nil {
+		b.config.OnStateChange(from, to)
+	}
+}
+
+// isNodeFailure reports whether err means the node could not serve the
+// request. Error replies and errors raised by the client itself don't count.
+func isNodeFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e Error
+	if errors.As(err, &e) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrGodis)
+}
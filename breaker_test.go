@@ -0,0 +1,73 @@
+package godis
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []CircuitState
+	config := &CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      10 * time.Millisecond,
+		OnStateChange: func(from, to CircuitState) {
+			changes = append(changes, to)
+		},
+	}
+	config.check()
+	b := newCircuitBreaker(config)
+
+	// Error replies don't count as failures
+	assert.Nil(t, b.allow())
+	b.done(Error{Type: "ERR"})
+	assert.Nil(t, b.allow())
+	b.done(io.EOF)
+	assert.Equal(t, CircuitClosed, b.state)
+
+	// Opens after consecutive failures
+	assert.Nil(t, b.allow())
+	b.done(io.EOF)
+	assert.Equal(t, CircuitOpen, b.state)
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// Half-open lets one probe through and reopens if it fails
+	time.Sleep(config.OpenTimeout)
+	assert.Nil(t, b.allow())
+	assert.Equal(t, CircuitHalfOpen, b.state)
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+	b.done(io.EOF)
+	assert.Equal(t, CircuitOpen, b.state)
+
+	// Closes once a probe succeeds
+	time.Sleep(config.OpenTimeout)
+	assert.Nil(t, b.allow())
+	b.done(nil)
+	assert.Equal(t, CircuitClosed, b.state)
+
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+}
+
+func TestCircuitBreakerCanceledProbe(t *testing.T) {
+	config := &CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond}
+	config.check()
+	b := newCircuitBreaker(config)
+	assert.Nil(t, b.allow())
+	b.done(io.EOF)
+	assert.Equal(t, CircuitOpen, b.state)
+
+	// A cancelled probe leaves the circuit half-open and frees its slot
+	time.Sleep(config.OpenTimeout)
+	assert.Nil(t, b.allow())
+	b.done(context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, b.state)
+	assert.Nil(t, b.allow())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// An answer of the node closes it
+	b.done(nil)
+	assert.Equal(t, CircuitClosed, b.state)
+}
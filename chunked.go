@@ -0,0 +1,154 @@
+package godis
+
+import (
+	"context"
+)
+
+const (
+	defaultChunkMaxCommands = 1000
+	defaultChunkMaxBytes    = 1 << 20
+)
+
+type ChunkConfig struct {
+	// The number of queued commands after which their replies are read.
+	// Default is 1000.
+	MaxCommands int
+	// The size in bytes of the queued requests after which their replies are
+	// read, even if there are fewer than MaxCommands commands. Default is 1 MiB.
+	MaxBytes int
+}
+
+func (c *ChunkConfig) check() {
+	if c.MaxCommands <= 0 {
+		c.MaxCommands = defaultChunkMaxCommands
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = defaultChunkMaxBytes
+	}
+}
+
+// ChunkedPipeline is a pipeline for bulk loads, whose memory doesn't grow
+// with the number of commands: the commands are sent as they are queued, and
+// their replies are read in chunks and passed to a callback instead of being
+// collected. The results returned by the methods queuing the commands are
+// still filled in when the replies are read.
+type ChunkedPipeline struct {
+	// The commands whose replies are not read yet.
+	queue    *Pipeline
+	config   ChunkConfig
+	conn     *Conn
+	counter  *countingConnection
+	protocol Protocol
+	onResult func(i int, res interface{}, err error)
+
+	// The index of the first queued command.
+	read int
+	// The first error of a command since the last Exec.
+	firstErr error
+	// The error that broke the connection, failing the next commands.
+	fatal error
+}
+
+// ChunkedPipeline returns a pipeline sending its commands on c. The replies
+// are read every MaxCommands commands or MaxBytes bytes of requests and
+// passed to onResult, which may be nil, with the index of their command. c
+// must not be used for other commands until Exec returns.
+func (c *Conn) ChunkedPipeline(config *ChunkConfig, onResult func(i int, res interface{}, err error)) *ChunkedPipeline {
+	config.check()
+	counter := &countingConnection{Connection: c.con}
+	return &ChunkedPipeline{
+		queue:   &Pipeline{},
+		config:  *config,
+		conn:    c,
+		counter: counter,
+		// One protocol for all the chunks, since its buffer may hold the
+		// replies of the next chunk.
+		protocol: c.client.newProtocol(counter),
+		onResult: onResult,
+	}
+}
+
+// send sends the last queued command and reads the replies of the queued
+// commands once a chunk is full. ctx is used until the replies are read.
+func (p *ChunkedPipeline) send(ctx context.Context) {
+	if p.fatal == nil && p.conn.closed {
+		p.fatal = ErrClosedConn
+	}
+	commands := p.queue.commands
+	if p.fatal == nil {
+		if err := commands[len(commands)-1].SendReq(ctx, p.protocol); err != nil {
+			p.conn.con.SetBroken()
+			p.fatal = err
+		}
+	}
+	if p.fatal != nil || len(commands) >= p.config.MaxCommands || p.counter.written >= p.config.MaxBytes {
+		p.flush(ctx)
+	}
+}
+
+// flush reads the replies of the queued commands, or fails them if the
+// connection is broken.
+func (p *ChunkedPipeline) flush(ctx context.Context) {
+	var res []interface{}
+	var errs []error
+	if p.fatal == nil {
+		var err error
+		res, errs, err = readResps(ctx, p.protocol, p.queue.commands)
+		if err != nil {
+			p.conn.con.SetBroken()
+			p.fatal = err
+		}
+	}
+	for i, cmdRes := range p.queue.results {
+		var r interface{}
+		err := p.fatal
+		if err == nil {
+			r, err = res[i], errs[i]
+		}
+		cmdRes.set(r, err)
+		if err != nil && p.firstErr == nil {
+			p.firstErr = err
+		}
+		if p.onResult != nil {
+			p.onResult(p.read+i, r, err)
+		}
+	}
+	p.read += len(p.queue.commands)
+	p.queue.commands, p.queue.results = p.queue.commands[:0], p.queue.results[:0]
+	p.counter.written = 0
+}
+
+// Exec reads the replies of the remaining commands. It returns the first
+// error of the commands since the previous Exec, all of them are passed to
+// onResult.
+func (p *ChunkedPipeline) Exec(ctx context.Context) error {
+	if len(p.queue.commands) > 0 {
+		p.flush(ctx)
+	}
+	err := p.firstErr
+	p.firstErr = nil
+	return err
+}
+
+// Discard can't drop the queued commands, which have already been sent. It
+// reads their replies like Exec, but only returns the error that broke the
+// connection.
+func (p *ChunkedPipeline) Discard(ctx context.Context) error {
+	if len(p.queue.commands) > 0 {
+		p.flush(ctx)
+	}
+	p.firstErr = nil
+	return p.fatal
+}
+
+// countingConnection counts the bytes written to a connection.
+type countingConnection struct {
+	Connection
+	written int
+}
+
+func (c *countingConnection) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := c.Connection.Write(ctx, p)
+	c.written += n
+	return n, err
+}
@@ -0,0 +1,73 @@
+package godis
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedPipeline(t *testing.T) {
+	var received int32
+	kv := kvHandler()
+	server := newFakeServer(t, func(args []string) string {
+		atomic.AddInt32(&received, 1)
+		return kv(args)
+	})
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+	conn, err := cli.Conn(ctx)
+	assert.Nil(t, err)
+
+	var indexes []int
+	var errs []error
+	p := conn.ChunkedPipeline(&ChunkConfig{MaxCommands: 3}, func(i int, res interface{}, err error) {
+		indexes = append(indexes, i)
+		errs = append(errs, err)
+	})
+	for i := 0; i < 7; i++ {
+		p.Set(ctx, "k"+strconv.Itoa(i), "v")
+		assert.LessOrEqual(t, len(p.queue.commands), 2)
+	}
+	// The commands are sent as they are queued
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&received) == 7 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, indexes)
+	get := p.Get(ctx, "k6")
+	bad := p.StrLen(ctx, "k6")
+	assert.Equal(t, "ERR", p.Exec(ctx).(Error).Type)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, indexes)
+	assert.Nil(t, errs[7])
+	assert.Equal(t, "v", *get.Val())
+	assert.Equal(t, errs[8], bad.Err())
+	assert.Nil(t, p.Exec(ctx))
+
+	// Discard reads the replies of the sent commands
+	p.StrLen(ctx, "k6")
+	assert.Nil(t, p.Discard(ctx))
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, indexes)
+	assert.Nil(t, p.Exec(ctx))
+
+	// Only the methods queuing commands are exposed
+	_, ok := interface{}(p).(Command)
+	assert.False(t, ok)
+
+	// A chunk is read once its requests reach MaxBytes
+	indexes = nil
+	p = conn.ChunkedPipeline(&ChunkConfig{MaxBytes: 1}, func(i int, res interface{}, err error) {
+		indexes = append(indexes, i)
+	})
+	incr := p.Incr(ctx, "n")
+	assert.Equal(t, []int{0}, indexes)
+	assert.Equal(t, int64(1), incr.Val())
+	assert.Nil(t, p.Exec(ctx))
+
+	assert.Nil(t, conn.Close())
+	p.Set(ctx, "k", "v")
+	assert.ErrorIs(t, p.Exec(ctx), ErrClosedConn)
+	assert.ErrorIs(t, p.Discard(ctx), ErrClosedConn)
+}
@@ -1,5 +1,7 @@
 package godis
 
+//go:generate go run ./cmd/gencommands
+
 import (
 	"context"
 	"math"
@@ -7,6 +9,7 @@ import (
 
 	"log"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -15,10 +18,23 @@ const (
 	defalutPoolMaxConns = math.MaxUint
 	defaultDailTimeOut  = time.Second
 	defaultConIdleTime  = 30 * time.Minute
+
+	defaultMultiplexWriteTimeout = 5 * time.Second
 )
 
 type ClientConfig struct {
 	Address string
+	// An ordered list of addresses of the same server, e.g. a virtual IP and DNS names. They are tried
+	// in turn when a connection fails to be established. It takes precedence over Address.
+	Addresses []string
+	// How often the host names of Addresses are resolved again in the background for the new
+	// connections, the connections already established are kept. Default is 30 seconds.
+	ResolveInterval time.Duration
+	// Called when connections start going to another address of Addresses, with the previous
+	// and the new address. It must not block.
+	OnAddressChange func(from, to string)
+	// The address list shared by the clients created from the config, see ActiveAddress.
+	addrs *addressList
 	// The maximum number of connections in the connection pool. Default is math.MaxUint.
 	PoolMaxConns uint
 	// The time to connect to the redis server. Default is 1 second.
@@ -28,6 +44,37 @@ type ClientConfig struct {
 	// the maxinum number of idle connections in the connection pool. Default is 0.
 	// If the value is 0, the maxinum number of idle connections is the same as the maxinum number of connections.
 	MaxIdleConns uint
+	// The number of connections shared by all commands in multiplexed mode. Concurrent commands are
+	// written one after another and their replies are matched back in order. Default is 0, which uses
+	// a connection pool instead.
+	MultiplexConns uint
+	// The maximum time of a write on a shared connection in multiplexed mode, after which the
+	// connection is closed and its commands fail. Default is 5 seconds.
+	MultiplexWriteTimeout time.Duration
+	// Coalesce the commands issued concurrently into pipelines. Default is false.
+	AutoPipeline bool
+	// How long a command may wait for others to join its pipeline. Default is 100 microseconds.
+	AutoPipelineWindow time.Duration
+	// The maximum number of commands in one automatic pipeline. Default is 100.
+	AutoPipelineBatchSize uint
+	// The policy to retry commands after transient failures. Default is nil, which disables retries.
+	Retry *RetryPolicy
+	// The circuit breaker that fails fast while the server is unreachable. Default is nil, which disables it.
+	CircuitBreaker *CircuitBreakerConfig
+	// The number of times Watch runs its function again after the transaction failed because a
+	// watched key was modified. Default is 0.
+	WatchRetries uint
+
+	// The URL of a SOCKS5 or HTTP CONNECT proxy to connect through, see ConnectionConfig.
+	Proxy string
+
+	// Socket options, see ConnectionConfig.
+	KeepAlive         time.Duration
+	KeepAliveInterval time.Duration
+	KeepAliveCount    int
+	DisableNoDelay    bool
+	ReadBufferSize    int
+	WriteBufferSize   int
 
 	// TLS
 	Tls           bool
@@ -39,12 +86,23 @@ type ClientConfig struct {
 func (c *ClientConfig) toConPoolConfig() *ConnectionPoolConfig {
 	return &ConnectionPoolConfig{
 		ConnectionConfig: ConnectionConfig{
-			Address:       c.Address,
-			DialTimeOut:   c.DailTimeOut,
-			Tls:           c.Tls,
-			TlsCertPath:   c.TlsCertPath,
-			TlsKeyPath:    c.TlsKeyPath,
-			TlsCaCertPath: c.TlsCaCertPath,
+			Address:           c.Address,
+			DialTimeOut:       c.DailTimeOut,
+			Addresses:         c.Addresses,
+			ResolveInterval:   c.ResolveInterval,
+			OnAddressChange:   c.OnAddressChange,
+			addrs:             c.addrs,
+			Proxy:             c.Proxy,
+			KeepAlive:         c.KeepAlive,
+			KeepAliveInterval: c.KeepAliveInterval,
+			KeepAliveCount:    c.KeepAliveCount,
+			DisableNoDelay:    c.DisableNoDelay,
+			ReadBufferSize:    c.ReadBufferSize,
+			WriteBufferSize:   c.WriteBufferSize,
+			Tls:               c.Tls,
+			TlsCertPath:       c.TlsCertPath,
+			TlsKeyPath:        c.TlsKeyPath,
+			TlsCaCertPath:     c.TlsCaCertPath,
 		},
 		ConIdleTime:   c.ConIdleTime,
 		MaxConNum:     c.PoolMaxConns,
@@ -52,8 +110,19 @@ func (c *ClientConfig) toConPoolConfig() *ConnectionPoolConfig {
 	}
 }
 
+// withAddress returns a copy of the config for the server at addr, used by
+// the clients made of several servers.
+func (c *ClientConfig) withAddress(addr string) *ClientConfig {
+	cfg := *c
+	cfg.Address = addr
+	cfg.Addresses = nil
+	cfg.OnAddressChange = nil
+	cfg.addrs = nil
+	return &cfg
+}
+
 func (c *ClientConfig) check() error {
-	if c.Address == "" {
+	if c.Address == "" && len(c.Addresses) == 0 {
 		return errors.Wrap(ErrGodis, "address is empty")
 	}
 	if c.PoolMaxConns == 0 {
@@ -65,6 +134,26 @@ func (c *ClientConfig) check() error {
 	if c.ConIdleTime == 0 {
 		c.ConIdleTime = defaultConIdleTime
 	}
+	if c.MultiplexWriteTimeout == 0 {
+		c.MultiplexWriteTimeout = defaultMultiplexWriteTimeout
+	}
+	if c.AutoPipelineWindow == 0 {
+		c.AutoPipelineWindow = defaultAutoPipelineWindow
+	}
+	if c.AutoPipelineBatchSize == 0 {
+		c.AutoPipelineBatchSize = defaultAutoPipelineBatchSize
+	}
+	if c.Proxy != "" {
+		if _, err := parseProxyURL(c.Proxy); err != nil {
+			return errors.Wrap(ErrGodis, err.Error())
+		}
+	}
+	if c.Retry != nil {
+		c.Retry.check()
+	}
+	if c.CircuitBreaker != nil {
+		c.CircuitBreaker.check()
+	}
 
 	hasTlsEmptyCfg := (c.TlsCertPath == "" && c.TlsCaCertPath == "" && c.TlsKeyPath == "")
 	if c.Tls && hasTlsEmptyCfg {
@@ -78,64 +167,182 @@ type Command interface {
 	ReadResp(ctx context.Context, protocol Protocol) (interface{}, error)
 }
 
+// readOnlyCommand is implemented by the commands that don't write, which can
+// be sent to replicas.
+type readOnlyCommand interface {
+	ReadOnly() bool
+}
+
+// readOnly is embedded in the commands that never write. SCAN is left out
+// since its cursor is only valid on the node that returned it.
+type readOnly struct{}
+
+func (readOnly) ReadOnly() bool {
+	return true
+}
+
+func isReadOnly(cmd Command) bool {
+	c, ok := cmd.(readOnlyCommand)
+	return ok && c.ReadOnly()
+}
+
 type Client interface {
+	// Close stops accepting commands and closes the idle connections.
+	// Connections used by in-flight commands are closed once they finish.
 	Close() error
+	// Shutdown is like Close but waits for in-flight commands until ctx is done,
+	// then closes every remaining connection.
+	Shutdown(ctx context.Context) error
 	Pipeline() *Pipeline
+	// Pipelined queues commands in a pipeline with fn and executes it.
+	Pipelined(ctx context.Context, fn func(p *Pipeline) error) ([]interface{}, error)
+	// TxPipeline returns a pipeline sent in a MULTI/EXEC transaction.
+	TxPipeline() *Pipeline
+	TxPipelined(ctx context.Context, fn func(p *Pipeline) error) ([]interface{}, error)
+	// Watch runs fn on a connection watching keys, see Watch.
+	Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error
+	// Conn checks a connection out of the pool for the exclusive use of the
+	// caller, see Conn. It is not supported in multiplexed mode.
+	Conn(ctx context.Context) (*Conn, error)
+	// Do sends a command that has no dedicated method.
+	Do(ctx context.Context, args ...string) (interface{}, error)
 
-	// String
-	Append(ctx context.Context, key string, value string) (int64, error)
-	Decr(ctx context.Context, key string) (int64, error)
-	DecrBy(ctx context.Context, key string, decrement int64) (int64, error)
-	Get(ctx context.Context, key string) (*string, error)
-	GetDel(ctx context.Context, key string) (*string, error)
-	GetEX(ctx context.Context, key string, args ...arg) (*string, error)
-	GetRange(ctx context.Context, key string, start int64, end int64) (string, error)
-	GetSet(ctx context.Context, key string, value string) (*string, error)
-	Incr(ctx context.Context, key string) (int64, error)
-	IncrBy(ctx context.Context, key string, increment int64) (int64, error)
-	IncrByFloat(ctx context.Context, key string, increment float64) (float64, error)
-	MGet(ctx context.Context, keys ...string) ([]*string, error)
-	MSet(ctx context.Context, kvs map[string]string) error
-	MSetNX(ctx context.Context, kvs map[string]string) (bool, error)
-	PSetEX(ctx context.Context, key, value string, milliseconds uint64) error
-	Lcs(ctx context.Context, key1 string, key2 string, args ...arg) (string, error)
-	LcsLen(ctx context.Context, key1 string, key2 string) (int64, error)
-	LcsIdx(ctx context.Context, key1 string, key2 string, args ...arg) (LcsIdxRes, error)
-	LcsIdxWithMatchLen(ctx context.Context, key1 string, key2 string, args ...arg) (LcsIdxRes, error)
-	Set(ctx context.Context, key string, value string, args ...arg) (bool, error)
-	SetEX(ctx context.Context, key, value string, seconds uint64) error
-	SetNX(ctx context.Context, key, value string) (bool, error)
-	SetRange(ctx context.Context, key string, offset uint, value string) (uint, error)
-	StrLen(ctx context.Context, key string) (uint, error)
-	SubStr(ctx context.Context, key string, start, end int) (string, error)
+	ScanIterator(args ...arg) *ScanIterator
+
+	// The commands generated from commands.json.
+	Commands
 }
 
+// cmdable implements the command methods on top of a function executing a
+// command, so that they are shared by every kind of client.
+type cmdable func(ctx context.Context, cmd Command) (interface{}, error)
+
 type client struct {
+	cmdable
 	conPool     ConnectionPool
 	newProtocol func(Connection) Protocol
 	config      *ClientConfig
+	breaker     *circuitBreaker
+	autoPipe    *autoPipeliner
 }
 
 func NewClient(config *ClientConfig) (Client, error) {
 	if err := config.check(); err != nil {
 		return nil, err
 	}
-	cp := NewConnectionPool(config.toConPoolConfig())
-	return &client{conPool: cp, newProtocol: NewProtocol, config: config}, nil
+	return newClient(config, config.newConnectionPool()), nil
+}
+
+func (c *ClientConfig) newConnectionPool() ConnectionPool {
+	config := c.toConPoolConfig()
+	var pool ConnectionPool
+	if c.MultiplexConns > 0 {
+		pool = newMultiplexPool(&config.ConnectionConfig, c.MultiplexConns, c.MultiplexWriteTimeout)
+	} else {
+		pool = NewConnectionPool(config)
+	}
+	c.addrs = config.addrs
+	return pool
+}
+
+// ActiveAddress returns the address of Addresses that the last connection of the clients created
+// from the config was established to, or Address if Addresses is empty.
+func (c *ClientConfig) ActiveAddress() string {
+	if c.addrs == nil {
+		return c.Address
+	}
+	return c.addrs.activeSeed()
+}
+
+func newClient(config *ClientConfig, conPool ConnectionPool) *client {
+	c := &client{conPool: conPool, newProtocol: NewProtocol, config: config}
+	c.cmdable = c.exec
+	if config.CircuitBreaker != nil {
+		c.breaker = newCircuitBreaker(config.CircuitBreaker)
+	}
+	if config.AutoPipeline {
+		c.autoPipe = newAutoPipeliner(c, config.AutoPipelineWindow, config.AutoPipelineBatchSize)
+	}
+	return c
 }
 
 func (c *client) Close() error {
 	return c.conPool.Close()
 }
 
-func (c *client) exec(ctx context.Context, cmd Command) (res interface{}, err error) {
+func (c *client) Shutdown(ctx context.Context) error {
+	return c.conPool.Shutdown(ctx)
+}
+
+func (c *client) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if c.autoPipe != nil && !isBatch(cmd) {
+		return c.autoPipe.exec(ctx, cmd)
+	}
+	return c.execWithRetry(ctx, cmd)
+}
+
+func (c *client) execWithRetry(ctx context.Context, cmd Command) (interface{}, error) {
+	for attempt := 1; ; attempt++ {
+		res, written, err := c.execOnce(ctx, cmd)
+		if b, ok := cmd.(*commandBatch); ok && err == nil && c.config.Retry != nil {
+			c.retryRejected(ctx, b, attempt)
+		}
+		if err == nil || c.config.Retry == nil || !c.config.Retry.shouldRetry(cmd, err, attempt, written) {
+			return res, err
+		}
+		// The results of a batch are still returned with its error.
+		if c.config.Retry.wait(ctx, attempt) != nil {
+			return res, err
+		}
+	}
+}
+
+// retryRejected sends again the commands of b rejected by the server with a
+// retryable error reply, such as LOADING, which have not been executed.
+func (c *client) retryRejected(ctx context.Context, b *commandBatch, attempt int) {
+	for ; ; attempt++ {
+		var rejected []int
+		for i, err := range b.errs {
+			if err != nil && c.config.Retry.shouldRetry(b.commands[i], err, attempt, true) {
+				rejected = append(rejected, i)
+			}
+		}
+		if len(rejected) == 0 || c.config.Retry.wait(ctx, attempt) != nil {
+			return
+		}
+
+		retry := &commandBatch{Pipeline: &Pipeline{}}
+		for _, i := range rejected {
+			retry.commands = append(retry.commands, b.commands[i])
+		}
+		if _, _, err := c.execOnce(ctx, retry); err != nil {
+			return
+		}
+		for j, i := range rejected {
+			b.res[i], b.errs[i] = retry.res[j], retry.errs[j]
+		}
+	}
+}
+
+// execOnce sends cmd on a pooled connection and reads its response. written
+// reports whether the request may have reached the server.
+func (c *client) execOnce(ctx context.Context, cmd Command) (res interface{}, written bool, err error) {
+	if c.breaker != nil {
+		if err = c.breaker.allow(); err != nil {
+			return
+		}
+		defer func() {
+			c.breaker.done(err)
+		}()
+	}
+
 	var con Connection
 	con, err = c.conPool.GetConnection()
 	if err != nil {
 		return
 	}
 	defer func() {
-		if err != nil {
+		if err != nil && !inSync(err) {
 			con.SetBroken()
 		}
 		err1 := c.conPool.Release(con)
@@ -144,24 +351,141 @@ func (c *client) exec(ctx context.Context, cmd Command) (res interface{}, err er
 		}
 	}()
 	protocol := c.newProtocol(con)
+	written = true
 	err = cmd.SendReq(ctx, protocol)
 	if err != nil {
 		return
 	}
 
+	res, err = readResp(ctx, protocol, cmd)
+	return
+}
+
+// inSync reports whether the connection is still in sync after err, i.e. its
+// reply was read completely: an error reply, including the ones of a
+// *PipelineError, or a transaction aborted by a watched key.
+func inSync(err error) bool {
+	var e Error
+	return errors.As(err, &e) || errors.Is(err, ErrTxFailed)
+}
+
+// readResp reads the reply of cmd. An error reply is returned as an Error,
+// except for the batches that read the error replies of each command.
+func readResp(ctx context.Context, protocol Protocol, cmd Command) (interface{}, error) {
+	if !isBatch(cmd) {
+		t, err := protocol.GetNextMsgType(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if t == ErrorType {
+			e, err := protocol.ReadError(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return nil, e
+		}
+	}
+	return cmd.ReadResp(ctx, protocol)
+}
+
+type doCommand struct {
+	args []string
+}
+
+// keyFirstCommands are the commands whose first argument is a key. The keys
+// of the other commands sent with Do are unknown, e.g. INFO or CONFIG have
+// none and EVAL has them after their number.
+var keyFirstCommands = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, name := range strings.Fields(`
+		APPEND DECR DECRBY GET GETDEL GETEX GETRANGE GETSET INCR INCRBY INCRBYFLOAT
+		LCS MGET MSET MSETNX PSETEX SET SETEX SETNX SETRANGE STRLEN SUBSTR
+		BITCOUNT BITFIELD BITFIELD_RO BITPOS GETBIT SETBIT
+		COPY DEL DUMP EXISTS EXPIRE EXPIREAT EXPIRETIME MOVE PERSIST PEXPIRE PEXPIREAT
+		PEXPIRETIME PTTL RENAME RENAMENX RESTORE SORT SORT_RO TOUCH TTL TYPE UNLINK WATCH
+		HDEL HEXISTS HGET HGETALL HINCRBY HINCRBYFLOAT HKEYS HLEN HMGET HMSET HRANDFIELD
+		HSCAN HSET HSETNX HSTRLEN HVALS
+		BLMOVE BLPOP BRPOP BRPOPLPUSH LINDEX LINSERT LLEN LMOVE LPOP LPOS LPUSH LPUSHX
+		LRANGE LREM LSET LTRIM RPOP RPOPLPUSH RPUSH RPUSHX
+		SADD SCARD SDIFF SDIFFSTORE SINTER SINTERSTORE SISMEMBER SMEMBERS SMISMEMBER SMOVE
+		SPOP SRANDMEMBER SREM SSCAN SUNION SUNIONSTORE
+		BZPOPMAX BZPOPMIN ZADD ZCARD ZCOUNT ZDIFFSTORE ZINCRBY ZINTERSTORE ZLEXCOUNT ZMSCORE
+		ZPOPMAX ZPOPMIN ZRANDMEMBER ZRANGE ZRANGEBYLEX ZRANGEBYSCORE ZRANGESTORE ZRANK ZREM
+		ZREMRANGEBYLEX ZREMRANGEBYRANK ZREMRANGEBYSCORE ZREVRANGE ZREVRANGEBYLEX
+		ZREVRANGEBYSCORE ZREVRANK ZSCAN ZSCORE ZUNIONSTORE
+		PFADD PFCOUNT PFMERGE
+		GEOADD GEODIST GEOHASH GEOPOS GEORADIUS GEORADIUSBYMEMBER GEORADIUSBYMEMBER_RO
+		GEORADIUS_RO GEOSEARCH GEOSEARCHSTORE
+		XACK XADD XAUTOCLAIM XCLAIM XDEL XLEN XPENDING XRANGE XREVRANGE XSETID XTRIM`) {
+		m[name] = true
+	}
+	return m
+}()
+
+// Keys returns the first argument after the command name when it is known to
+// be a key, nil otherwise so that the command goes to any node.
+func (c *doCommand) Keys() []string {
+	if len(c.args) < 2 || !keyFirstCommands[strings.ToUpper(c.args[0])] {
+		return nil
+	}
+	return c.args[1:2]
+}
+
+func (c *doCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, c.args, nil)
+}
+
+func (c *doCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readReply(ctx, protocol)
+}
+
+// Do sends a command that has no dedicated method. The reply is returned as
+// []byte for a simple string, *[]byte for a bulk string, int64 for an integer,
+// []interface{} for an array or a map and nil for null, the elements of an
+// array being decoded the same way.
+func (c cmdable) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.Wrap(ErrGodis, "empty command")
+	}
+	return c(ctx, &doCommand{args: args})
+}
+
+// readReply reads a reply of any type.
+func readReply(ctx context.Context, protocol Protocol) (interface{}, error) {
 	t, err := protocol.GetNextMsgType(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if t == ErrorType {
-		e1, err := protocol.ReadError(ctx)
+	switch t {
+	case SimpleStringType:
+		return protocol.ReadSimpleString(ctx)
+	case BulkStringType:
+		r, err := protocol.ReadBulkString(ctx)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return r, nil
+	case IntegerType:
+		return protocol.ReadInteger(ctx)
+	case ArrayType:
+		r, err := protocol.ReadArray(ctx)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return r, nil
+	case MapType:
+		return protocol.ReadMap(ctx)
+	case ErrorType:
+		e, err := protocol.ReadError(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return nil, e1
+		return nil, e
+	case NullType:
+		return nil, protocol.ReadNull(ctx)
+	default:
+		return nil, errors.Wrap(errInvalidMsg, "invalid msg type")
 	}
-
-	return cmd.ReadResp(ctx, protocol)
 }
 
 type arg func() []string
@@ -198,6 +522,24 @@ func PXATArg(unixTimeMiliseconds uint64) arg {
 	}
 }
 
+func MATCHArg(pattern string) arg {
+	return func() []string {
+		return []string{"MATCH", pattern}
+	}
+}
+
+func COUNTArg(count uint64) arg {
+	return func() []string {
+		return []string{"COUNT", strconv.FormatUint(count, 10)}
+	}
+}
+
+func TYPEArg(typ string) arg {
+	return func() []string {
+		return []string{"TYPE", typ}
+	}
+}
+
 var PERSISTArg arg = func() []string {
 	return []string{"PERSIST"}
 }
@@ -248,3 +590,42 @@ func readRespStringOrNil(ctx context.Context, protocol Protocol) (*string, error
 		return (*string)(nil), errors.WithStack(errUnexpectedRes)
 	}
 }
+
+func readString(ctx context.Context, protocol Protocol) (interface{}, error) {
+	r, err := protocol.ReadBulkString(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	return string(*r), nil
+}
+
+func readUint(ctx context.Context, protocol Protocol) (interface{}, error) {
+	r, err := protocol.ReadInteger(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return uint(r), nil
+}
+
+// readBool reads an integer reply that is 1 for true.
+func readBool(ctx context.Context, protocol Protocol) (interface{}, error) {
+	r, err := protocol.ReadInteger(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r == 1, nil
+}
+
+func readFloat(ctx context.Context, protocol Protocol) (interface{}, error) {
+	r, err := protocol.ReadBulkString(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	return strconv.ParseFloat(string(*r), 64)
+}
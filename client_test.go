@@ -23,9 +23,9 @@ func initTestClient(ctr *gomock.Controller) {
 	config := &ClientConfig{
 		Address: "1.1.1.1:6379",
 	}
-	testClient = &client{config: config, conPool: mkPool,
-		newProtocol: newProtocol,
-	}
+	c := newClient(config, mkPool)
+	c.newProtocol = newProtocol
+	testClient = c
 }
 
 func TestPipeline(t *testing.T) {
@@ -40,7 +40,7 @@ func TestPipeline(t *testing.T) {
 	// Set
 	mkProtocol.EXPECT().WriteBulkStringArray(ctx, [][]byte{[]byte("SET"), key, val}).Return(nil).Times(1)
 	mkProtocol.EXPECT().GetNextMsgType(ctx).Return(SimpleStringType, nil).Times(2)
-	mkProtocol.EXPECT().GetNextMsgType(ctx).Return(BulkStringType, nil).Times(1)
+	mkProtocol.EXPECT().GetNextMsgType(ctx).Return(BulkStringType, nil).Times(2)
 	mkProtocol.EXPECT().ReadSimpleString(ctx).Return([]byte("OK"), nil).Times(1)
 
 	// Get
@@ -61,3 +61,101 @@ func TestPipeline(t *testing.T) {
 	// Get result
 	assert.Equal(t, string(val), *res[1].(*string))
 }
+
+func TestPipelineErrors(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	// The replies after an error reply are still read
+	p := cli.Pipeline()
+	p.Set("k", "v")
+	p.GetDel("k")
+	p.Get("k")
+	res, err := p.Exec(ctx)
+	var pe *PipelineError
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, 3, len(res))
+	assert.True(t, res[0].(bool))
+	assert.Nil(t, res[1])
+	assert.Equal(t, "v", *res[2].(*string))
+	assert.Nil(t, pe.Errors[0])
+	assert.Equal(t, "ERR", pe.Errors[1].(Error).Type)
+	assert.Nil(t, pe.Errors[2])
+	var e Error
+	assert.ErrorAs(t, err, &e)
+
+	// The connection is still in sync and reused
+	v, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+	_, err = cli.GetDel(ctx, "k")
+	assert.NotNil(t, err)
+	_, err = cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.ConNum())
+}
+
+func TestPipelineResults(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	var set *BoolCmd
+	var incr *IntCmd
+	var get, getDel *NullStringCmd
+	var mget *NullStringSliceCmd
+	_, err = cli.Pipelined(ctx, func(p *Pipeline) error {
+		set = p.Set("k", "v")
+		incr = p.Incr("n")
+		getDel = p.GetDel("k")
+		get = p.Get("k")
+		mget = p.MGet("k", "missing")
+		return nil
+	})
+	var pe *PipelineError
+	assert.ErrorAs(t, err, &pe)
+	assert.True(t, set.Val())
+	assert.Nil(t, set.Err())
+	n, err := incr.Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, "ERR", getDel.Err().(Error).Type)
+	assert.Nil(t, getDel.Val())
+	assert.Equal(t, "v", *get.Val())
+	assert.Equal(t, []*string{get.Val(), nil}, mget.Val())
+
+	// Nothing is sent when fn fails
+	_, err = cli.Pipelined(ctx, func(p *Pipeline) error {
+		p.Set("k", "v2")
+		return ErrGodis
+	})
+	assert.ErrorIs(t, err, ErrGodis)
+	v, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+
+	// A failed pipeline fails every command
+	p := cli.Pipeline()
+	strLen := p.StrLen("k")
+	assert.Nil(t, cli.Close())
+	_, err = p.Exec(ctx)
+	assert.ErrorIs(t, err, ErrClosedPool)
+	assert.ErrorIs(t, strLen.Err(), ErrClosedPool)
+}
+
+func TestPipelineRequests(t *testing.T) {
+	p := &Pipeline{}
+	p.GetEX("k", EXArg(10))
+	p.PSetEX("k", "v", 100)
+	p.MSet(map[string]string{"k": "v"})
+	assert.Equal(t, [][]string{
+		{"GETEX", "k", "EX", "10"},
+		{"PSETEX", "k", "100", "v"},
+		{"MSET", "k", "v"},
+	}, commandRequests(p))
+}
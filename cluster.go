@@ -0,0 +1,738 @@
+package godis
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultClusterRefreshInterval = 10 * time.Second
+	defaultClusterMaxRedirects    = 3
+)
+
+type ClusterConfig struct {
+	// The seed nodes are Address and Addresses. The other settings apply to
+	// the connections to every node.
+	ClientConfig
+	// The interval between two refreshes of the slot map. Default is 10 seconds.
+	RefreshInterval time.Duration
+	// The maximum number of MOVED or ASK redirects followed by a command. Default is 3.
+	MaxRedirects int
+}
+
+func (c *ClusterConfig) check() error {
+	if err := c.ClientConfig.check(); err != nil {
+		return err
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = defaultClusterRefreshInterval
+	}
+	if c.MaxRedirects == 0 {
+		c.MaxRedirects = defaultClusterMaxRedirects
+	}
+	return nil
+}
+
+func (c *ClusterConfig) seeds() []string {
+	if len(c.Addresses) > 0 {
+		return c.Addresses
+	}
+	return []string{c.Address}
+}
+
+// ClusterClient is a client of Redis Cluster. Commands are sent to the primary
+// serving the slot of their keys, following the MOVED and ASK redirects while
+// slots are moved between nodes. The slot map is refreshed in the background,
+// and as soon as a MOVED redirect shows that it is stale.
+type ClusterClient struct {
+	cmdable
+	config *ClusterConfig
+	nodes  *nodeRegistry
+
+	// *clusterState, nil until the slot map is loaded.
+	state        atomic.Value
+	refreshMutex sync.Mutex
+	refreshCh    chan struct{}
+}
+
+type clusterShard struct {
+	primary  string
+	replicas []string
+	// The slot ranges served by the shard, as start and end pairs.
+	slots [][2]int
+}
+
+type clusterState struct {
+	shards []*clusterShard
+	slots  [clusterSlotNum]*clusterShard
+}
+
+func newClusterState(shards []*clusterShard) *clusterState {
+	s := &clusterState{shards: shards}
+	for _, shard := range shards {
+		for _, r := range shard.slots {
+			for i := r[0]; i <= r[1] && i < clusterSlotNum; i++ {
+				s.slots[i] = shard
+			}
+		}
+	}
+	return s
+}
+
+// primary returns the primary serving slot, or a random primary for the
+// commands without key.
+func (s *clusterState) primary(slot int) string {
+	if slot >= 0 && s.slots[slot] != nil {
+		return s.slots[slot].primary
+	}
+	return s.shards[rand.Intn(len(s.shards))].primary
+}
+
+var _ Client = (*ClusterClient)(nil)
+
+func NewClusterClient(config *ClusterConfig) (*ClusterClient, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	c := &ClusterClient{
+		config:    config,
+		nodes:     newNodeRegistry(&config.ClientConfig),
+		refreshCh: make(chan struct{}, 1),
+	}
+	c.cmdable = c.exec
+	c.nodes.run(c.refreshLoop)
+	return c, nil
+}
+
+func (c *ClusterClient) Pipeline() *Pipeline {
+	return &Pipeline{exec: c.exec}
+}
+
+func (c *ClusterClient) Conn(ctx context.Context) (*Conn, error) {
+	return nil, errors.Wrap(ErrGodis, "dedicated connections are not supported in cluster mode")
+}
+
+// Watch runs the transaction on the primary of the slot of keys, see
+// (*client).Watch. The keys must be in one slot.
+func (c *ClusterClient) Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error {
+	if len(keys) == 0 {
+		return errors.Wrap(ErrGodis, "no key to watch")
+	}
+	slot, err := commandSlot(&watchCommand{keys: keys})
+	if err != nil {
+		return errors.Wrap(err, "use a hash tag to put the watched keys in one slot")
+	}
+	state, err := c.getState(ctx)
+	if err != nil {
+		return err
+	}
+	node, err := c.node(state.primary(slot))
+	if err != nil {
+		return err
+	}
+	return node.Watch(ctx, fn, keys...)
+}
+
+// Close stops the refresh of the slot map and closes the clients of every
+// node.
+func (c *ClusterClient) Close() error {
+	return c.nodes.close(func(node *client) error {
+		return node.Close()
+	})
+}
+
+func (c *ClusterClient) Shutdown(ctx context.Context) error {
+	return c.nodes.close(func(node *client) error {
+		return node.Shutdown(ctx)
+	})
+}
+
+// node returns the client of the node at addr.
+func (c *ClusterClient) node(addr string) (*client, error) {
+	return c.nodes.node(addr)
+}
+
+func (c *ClusterClient) loadState() *clusterState {
+	s, _ := c.state.Load().(*clusterState)
+	return s
+}
+
+// getState returns the slot map, loading it on first use.
+func (c *ClusterClient) getState(ctx context.Context) (*clusterState, error) {
+	if s := c.loadState(); s != nil {
+		return s, nil
+	}
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	if s := c.loadState(); s != nil {
+		return s, nil
+	}
+	if err := c.refreshLocked(ctx); err != nil {
+		return nil, err
+	}
+	return c.loadState(), nil
+}
+
+func (c *ClusterClient) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if p, ok := cmd.(*Pipeline); ok {
+		return c.execPipeline(ctx, p)
+	}
+	slot, err := commandSlot(cmd)
+	if errors.Is(err, ErrCrossSlot) {
+		if m, ok := cmd.(multiKeyCommand); ok {
+			return c.execMultiKey(ctx, m)
+		}
+		return nil, errors.Wrap(err, "the command can't be split by slot, use a hash tag to put its keys in one slot")
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, err := c.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := state.primary(slot)
+	asking := false
+	for redirects := 0; ; redirects++ {
+		node, err := c.node(addr)
+		if err != nil {
+			return nil, err
+		}
+		var res interface{}
+		if asking {
+			res, err = node.exec(ctx, &askingCommand{Command: cmd})
+		} else {
+			res, err = node.exec(ctx, cmd)
+		}
+		if err == nil || redirects >= c.config.MaxRedirects {
+			return res, err
+		}
+
+		if to, ask, ok := parseRedirect(err, addr); ok {
+			addr, asking = to, ask
+			if !ask {
+				c.triggerRefresh()
+			}
+			continue
+		}
+		if c.nodes.removed(err) {
+			addr, asking = c.loadState().primary(slot), false
+			continue
+		}
+		if isNodeFailure(err) {
+			c.triggerRefresh()
+		}
+		return res, err
+	}
+}
+
+// execMultiKey splits a multi-key command whose keys are in different slots
+// into one command per slot, sends them as a pipeline and merges their
+// results. The command is no longer atomic.
+func (c *ClusterClient) execMultiKey(ctx context.Context, cmd multiKeyCommand) (interface{}, error) {
+	keys := cmd.Keys()
+	groups := groupBySlot(keys)
+	p := &Pipeline{}
+	for _, indexes := range groups {
+		groupKeys := make([]string, 0, len(indexes))
+		for _, i := range indexes {
+			groupKeys = append(groupKeys, keys[i])
+		}
+		p.commands = append(p.commands, cmd.withKeys(groupKeys))
+	}
+	res, err := c.execPipeline(ctx, p)
+	var pe *PipelineError
+	if errors.As(err, &pe) {
+		return nil, pe.Unwrap()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cmd.merge(groups, res.([]interface{})), nil
+}
+
+// ClusterError is returned by the operations run on several nodes, with the
+// error of each node that failed.
+type ClusterError struct {
+	// The errors by node address.
+	Errors map[string]error
+}
+
+func (e *ClusterError) Error() string {
+	addrs := make([]string, 0, len(e.Errors))
+	for addr := range e.Errors {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	msgs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		msgs = append(msgs, addr+": "+e.Errors[addr].Error())
+	}
+	return strconv.Itoa(len(addrs)) + " node(s) failed: " + strings.Join(msgs, "; ")
+}
+
+// ForEachPrimary calls fn concurrently with the client of every primary, e.g.
+// to run FLUSHDB or SCRIPT LOAD on the whole cluster. The errors returned by
+// fn are gathered in a *ClusterError.
+func (c *ClusterClient) ForEachPrimary(ctx context.Context, fn func(ctx context.Context, addr string, node Client) error) error {
+	state, err := c.getState(ctx)
+	if err != nil {
+		return err
+	}
+	addrs := make([]string, 0, len(state.shards))
+	for _, shard := range state.shards {
+		addrs = append(addrs, shard.primary)
+	}
+	return c.nodes.forEach(ctx, addrs, fn)
+}
+
+// ForEachNode is like ForEachPrimary for the primaries and the replicas.
+func (c *ClusterClient) ForEachNode(ctx context.Context, fn func(ctx context.Context, addr string, node Client) error) error {
+	state, err := c.getState(ctx)
+	if err != nil {
+		return err
+	}
+	var addrs []string
+	for _, shard := range state.shards {
+		addrs = append(addrs, shard.primary)
+		addrs = append(addrs, shard.replicas...)
+	}
+	return c.nodes.forEach(ctx, addrs, fn)
+}
+
+// Scan is not supported in cluster mode since a cursor is only valid on one
+// node, see ScanIterator or ForEachPrimary.
+func (c *ClusterClient) Scan(ctx context.Context, cursor uint64, args ...arg) (ScanRes, error) {
+	return ScanRes{}, errors.Wrap(ErrGodis, "SCAN cursors are per node in cluster mode, use ScanIterator")
+}
+
+// ScanIterator returns an iterator over the keys of every primary, which are
+// scanned one after the other. The primaries are the ones of the slot map
+// when the iteration starts.
+func (c *ClusterClient) ScanIterator(args ...arg) *ScanIterator {
+	it := &ScanIterator{args: args}
+	it.init = func(ctx context.Context) error {
+		state, err := c.getState(ctx)
+		if err != nil {
+			return err
+		}
+		for _, shard := range state.shards {
+			addr := shard.primary
+			it.sources = append(it.sources, scanSource{addr: addr, scan: func(ctx context.Context, cursor uint64, args ...arg) (ScanRes, error) {
+				node, err := c.node(addr)
+				if err != nil {
+					return ScanRes{}, err
+				}
+				return node.Scan(ctx, cursor, args...)
+			}})
+		}
+		return nil
+	}
+	return it
+}
+
+// pipelineCall is a command of a pipeline and the node it is sent to.
+type pipelineCall struct {
+	index  int
+	addr   string
+	asking bool
+}
+
+// execPipeline splits the pipeline by node and sends the parts in parallel.
+// The commands redirected by MOVED or ASK are sent again to their new node,
+// and the results are returned in the order of the commands.
+func (c *ClusterClient) execPipeline(ctx context.Context, p *Pipeline) (interface{}, error) {
+	state, err := c.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]pipelineCall, 0, len(p.commands))
+	for i, cmd := range p.commands {
+		slot, err := commandSlot(cmd)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, pipelineCall{index: i, addr: state.primary(slot)})
+	}
+
+	res := make([]interface{}, len(p.commands))
+	errs := make([]error, len(p.commands))
+	for redirects := 0; len(calls) > 0; redirects++ {
+		byNode := make(map[string][]pipelineCall)
+		for _, call := range calls {
+			byNode[call.addr] = append(byNode[call.addr], call)
+		}
+
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		calls = nil
+		for addr, nodeCalls := range byNode {
+			wg.Add(1)
+			go func(addr string, nodeCalls []pipelineCall) {
+				defer wg.Done()
+				retry := c.execNodePipeline(ctx, p, addr, nodeCalls, res, errs)
+
+				mutex.Lock()
+				calls = append(calls, retry...)
+				mutex.Unlock()
+			}(addr, nodeCalls)
+		}
+		wg.Wait()
+
+		if redirects >= c.config.MaxRedirects {
+			break
+		}
+		for _, call := range calls {
+			errs[call.index] = nil
+		}
+	}
+
+	return pipelineResult(res, errs)
+}
+
+// execNodePipeline sends the commands of calls to the node at addr and
+// returns the calls to send again after a redirect. Every call has its own
+// index, so res and errs are written without lock.
+func (c *ClusterClient) execNodePipeline(ctx context.Context, p *Pipeline, addr string, calls []pipelineCall, res []interface{}, errs []error) []pipelineCall {
+	node, err := c.node(addr)
+	if err != nil {
+		for _, call := range calls {
+			errs[call.index] = err
+		}
+		return nil
+	}
+
+	b := &commandBatch{Pipeline: &Pipeline{}}
+	for _, call := range calls {
+		cmd := p.commands[call.index]
+		if call.asking {
+			cmd = &askingCommand{Command: cmd}
+		}
+		b.commands = append(b.commands, cmd)
+	}
+	if _, err := node.execWithRetry(ctx, b); err != nil {
+		retry := c.nodes.removed(err)
+		if isNodeFailure(err) {
+			c.triggerRefresh()
+		}
+		var redirected []pipelineCall
+		for _, call := range calls {
+			errs[call.index] = err
+			if retry {
+				slot, _ := commandSlot(p.commands[call.index])
+				redirected = append(redirected, pipelineCall{index: call.index, addr: c.loadState().primary(slot)})
+			}
+		}
+		return redirected
+	}
+
+	var redirected []pipelineCall
+	for i, call := range calls {
+		res[call.index], errs[call.index] = b.res[i], b.errs[i]
+		if to, ask, ok := parseRedirect(b.errs[i], addr); ok {
+			if !ask {
+				c.triggerRefresh()
+			}
+			redirected = append(redirected, pipelineCall{index: call.index, addr: to, asking: ask})
+		}
+	}
+	return redirected
+}
+
+// parseRedirect returns the address of a MOVED or ASK redirect. The host is
+// empty when it is the same as the node replying.
+func parseRedirect(err error, from string) (addr string, ask bool, ok bool) {
+	var e Error
+	if !errors.As(err, &e) || (e.Type != "MOVED" && e.Type != "ASK") {
+		return "", false, false
+	}
+	// <slot> <host>:<port>
+	fields := strings.Fields(e.Msg)
+	if len(fields) != 2 {
+		return "", false, false
+	}
+	addr = fields[1]
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		fromHost, _, _ := net.SplitHostPort(from)
+		addr = net.JoinHostPort(fromHost, port)
+	}
+	return addr, e.Type == "ASK", true
+}
+
+func (c *ClusterClient) triggerRefresh() {
+	select {
+	case c.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *ClusterClient) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.refreshCh:
+		}
+		refreshCtx, cancel := context.WithTimeout(ctx, c.config.RefreshInterval)
+		if err := c.refresh(refreshCtx); err != nil && ctx.Err() == nil {
+			log.Println("failed to refresh cluster slots: ", err)
+		}
+		cancel()
+	}
+}
+
+// refresh loads the slot map from the first node that answers, trying the
+// known nodes in random order and then the seeds.
+func (c *ClusterClient) refresh(ctx context.Context) error {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	return c.refreshLocked(ctx)
+}
+
+func (c *ClusterClient) refreshLocked(ctx context.Context) error {
+	var addrs []string
+	if s := c.loadState(); s != nil {
+		for _, shard := range s.shards {
+			addrs = append(addrs, shard.primary)
+			addrs = append(addrs, shard.replicas...)
+		}
+		rand.Shuffle(len(addrs), func(i, j int) {
+			addrs[i], addrs[j] = addrs[j], addrs[i]
+		})
+	}
+	addrs = append(addrs, c.config.seeds()...)
+
+	var lastErr error
+	for _, addr := range addrs {
+		node, err := c.node(addr)
+		if err != nil {
+			return err
+		}
+		shards, err := loadClusterShards(ctx, node, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.setState(newClusterState(shards))
+		return nil
+	}
+	return errors.Wrap(lastErr, "failed to load cluster slots")
+}
+
+// setState replaces the slot map and closes the clients of the nodes that
+// are no longer part of it. The clients of the seeds are kept for the next
+// refreshes.
+func (c *ClusterClient) setState(s *clusterState) {
+	c.state.Store(s)
+
+	known := make(map[string]bool)
+	for _, addr := range c.config.seeds() {
+		known[addr] = true
+	}
+	for _, shard := range s.shards {
+		known[shard.primary] = true
+		for _, r := range shard.replicas {
+			known[r] = true
+		}
+	}
+	c.nodes.retain(known)
+}
+
+// loadClusterShards reads the topology with CLUSTER SHARDS, or CLUSTER SLOTS
+// on servers older than 7.0.
+func loadClusterShards(ctx context.Context, node *client, addr string) ([]*clusterShard, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tls := node.config.Tls
+
+	res, err := node.execWithRetry(ctx, &doCommand{args: []string{"CLUSTER", "SHARDS"}})
+	var e Error
+	if errors.As(err, &e) {
+		res, err = node.execWithRetry(ctx, &doCommand{args: []string{"CLUSTER", "SLOTS"}})
+		if err != nil {
+			return nil, err
+		}
+		return parseClusterSlots(res, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterShards(res, host, tls)
+}
+
+// parseClusterShards parses the reply of CLUSTER SHARDS, an array of shards
+// each given as alternating field names and values. The "slots" field holds
+// start and end slot pairs and the "nodes" field the nodes, also given as
+// field names and values.
+func parseClusterShards(res interface{}, host string, tls bool) ([]*clusterShard, error) {
+	items, ok := res.([]interface{})
+	if !ok {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	var shards []*clusterShard
+	for _, item := range items {
+		fields, ok := replyMap(item)
+		if !ok {
+			return nil, errors.WithStack(errUnexpectedRes)
+		}
+		slots, _ := fields["slots"].([]interface{})
+		nodes, _ := fields["nodes"].([]interface{})
+		shard := &clusterShard{}
+		for i := 0; i+1 < len(slots); i += 2 {
+			start, ok1 := slots[i].(int64)
+			end, ok2 := slots[i+1].(int64)
+			if !ok1 || !ok2 {
+				return nil, errors.WithStack(errUnexpectedRes)
+			}
+			shard.slots = append(shard.slots, [2]int{int(start), int(end)})
+		}
+		for _, n := range nodes {
+			node, ok := replyMap(n)
+			if !ok {
+				return nil, errors.WithStack(errUnexpectedRes)
+			}
+			if replyString(node["health"]) != "online" {
+				continue
+			}
+			nodeHost := replyString(node["endpoint"])
+			if nodeHost == "" || nodeHost == "?" {
+				nodeHost = replyString(node["ip"])
+			}
+			if nodeHost == "" {
+				nodeHost = host
+			}
+			port, _ := node["port"].(int64)
+			if tlsPort, ok := node["tls-port"].(int64); tls && ok {
+				port = tlsPort
+			}
+			addr := net.JoinHostPort(nodeHost, strconv.FormatInt(port, 10))
+			if replyString(node["role"]) == "master" {
+				shard.primary = addr
+			} else {
+				shard.replicas = append(shard.replicas, addr)
+			}
+		}
+		if shard.primary != "" && len(shard.slots) > 0 {
+			shards = append(shards, shard)
+		}
+	}
+	if len(shards) == 0 {
+		return nil, errors.Wrap(errUnexpectedRes, "no slot is served")
+	}
+	return shards, nil
+}
+
+// parseClusterSlots parses the reply of CLUSTER SLOTS, an array of slot
+// ranges made of the start slot, the end slot, the primary and the replicas.
+// A node is an array starting with its host and port.
+func parseClusterSlots(res interface{}, host string) ([]*clusterShard, error) {
+	items, ok := res.([]interface{})
+	if !ok {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	// Slot ranges served by the same primary are grouped in one shard.
+	byPrimary := make(map[string]*clusterShard)
+	var shards []*clusterShard
+	for _, item := range items {
+		r, ok := item.([]interface{})
+		if !ok || len(r) < 3 {
+			return nil, errors.WithStack(errUnexpectedRes)
+		}
+		start, ok1 := r[0].(int64)
+		end, ok2 := r[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, errors.WithStack(errUnexpectedRes)
+		}
+		var addrs []string
+		for _, n := range r[2:] {
+			node, ok := n.([]interface{})
+			if !ok || len(node) < 2 {
+				return nil, errors.WithStack(errUnexpectedRes)
+			}
+			nodeHost := replyString(node[0])
+			if nodeHost == "" || nodeHost == "?" {
+				nodeHost = host
+			}
+			port, _ := node[1].(int64)
+			addrs = append(addrs, net.JoinHostPort(nodeHost, strconv.FormatInt(port, 10)))
+		}
+		shard, ok := byPrimary[addrs[0]]
+		if !ok {
+			shard = &clusterShard{primary: addrs[0], replicas: addrs[1:]}
+			byPrimary[addrs[0]] = shard
+			shards = append(shards, shard)
+		}
+		shard.slots = append(shard.slots, [2]int{int(start), int(end)})
+	}
+	if len(shards) == 0 {
+		return nil, errors.Wrap(errUnexpectedRes, "no slot is served")
+	}
+	return shards, nil
+}
+
+// replyMap converts a map reply, or an array of alternating keys and values,
+// to a map.
+func replyMap(v interface{}) (map[string]interface{}, bool) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr)%2 != 0 {
+		return nil, false
+	}
+	m := make(map[string]interface{}, len(arr)/2)
+	for i := 0; i < len(arr); i += 2 {
+		m[replyString(arr[i])] = arr[i+1]
+	}
+	return m, true
+}
+
+// replyString returns the value of a simple or bulk string reply.
+func replyString(v interface{}) string {
+	switch s := v.(type) {
+	case []byte:
+		return string(s)
+	case *[]byte:
+		if s != nil {
+			return string(*s)
+		}
+	}
+	return ""
+}
+
+// askingCommand sends ASKING before cmd so that a node importing the slot of
+// cmd accepts it.
+type askingCommand struct {
+	Command
+}
+
+func (c *askingCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	if err := sendReq(ctx, protocol, []string{"ASKING"}, nil); err != nil {
+		return err
+	}
+	return c.Command.SendReq(ctx, protocol)
+}
+
+func (c *askingCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	if _, err := readStatus(ctx, protocol, "OK"); err != nil {
+		return nil, err
+	}
+	return readResp(ctx, protocol, c.Command)
+}
+
+func (c *askingCommand) Idempotent() bool {
+	return isIdempotent(c.Command)
+}
@@ -0,0 +1,485 @@
+package godis
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCluster is a cluster of fake servers sharing one keyspace. Every node
+// checks that it owns the slot of the keys it's asked for and replies MOVED or
+// ASK like Redis Cluster does.
+type fakeCluster struct {
+	servers []*fakeServer
+	kv      func(args []string) string
+
+	mutex sync.Mutex
+	owner [clusterSlotNum]int
+	// The slots being migrated, to the node importing them.
+	migrating map[int]int
+	asking    map[int]bool
+	// Reply with an error to CLUSTER SHARDS, like Redis before 7.0.
+	noShards bool
+	commands []string
+	keys     map[string]bool
+}
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	c := &fakeCluster{kv: kvHandler(), migrating: map[int]int{}, asking: map[int]bool{}, keys: map[string]bool{}}
+	for i := 0; i < n; i++ {
+		i := i
+		c.servers = append(c.servers, newFakeServer(t, func(args []string) string {
+			return c.handle(i, args)
+		}))
+	}
+	for slot := range c.owner {
+		c.owner[slot] = slot * n / clusterSlotNum
+	}
+	return c
+}
+
+func (c *fakeCluster) setOwner(slot, node int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.owner[slot] = node
+}
+
+func (c *fakeCluster) migrate(slot, to int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.migrating[slot] = to
+}
+
+func (c *fakeCluster) Commands() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.commands
+}
+
+func (c *fakeCluster) handle(node int, args []string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.commands = append(c.commands, strconv.Itoa(node)+" "+strings.Join(args, " "))
+
+	switch strings.ToUpper(args[0]) {
+	case "CLUSTER":
+		if strings.ToUpper(args[1]) == "SHARDS" {
+			if c.noShards {
+				return "-ERR unknown subcommand 'SHARDS'\r\n"
+			}
+			return c.shardsReply()
+		}
+		return c.slotsReply()
+	case "ASKING":
+		c.asking[node] = true
+		return "+OK\r\n"
+	case "INFO":
+		return respBulk("# Cluster\r\ncluster_enabled:1\r\n")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "SCAN":
+		return c.scanReply(node, args)
+	case "DBSIZE":
+		return respInt(len(c.ownedKeys(node)))
+	case "SET", "MSET":
+		for _, k := range fakeCommandKeys(args) {
+			c.keys[k] = true
+		}
+	}
+
+	asking := c.asking[node]
+	c.asking[node] = false
+	if keys := fakeCommandKeys(args); len(keys) > 0 {
+		slot := hashSlot(keys[0])
+		for _, k := range keys[1:] {
+			if hashSlot(k) != slot {
+				return "-CROSSSLOT Keys in request don't hash to the same slot\r\n"
+			}
+		}
+		if to, ok := c.migrating[slot]; ok && c.owner[slot] == node {
+			return "-ASK " + strconv.Itoa(slot) + " " + c.servers[to].Addr() + "\r\n"
+		}
+		if c.owner[slot] != node && !(asking && c.migrating[slot] == node) {
+			return "-MOVED " + strconv.Itoa(slot) + " " + c.servers[c.owner[slot]].Addr() + "\r\n"
+		}
+	}
+	return c.kv(args)
+}
+
+func fakeCommandKeys(args []string) []string {
+	switch strings.ToUpper(args[0]) {
+	case "MSET", "MSETNX":
+		var keys []string
+		for i := 1; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "MGET", "DEL", "UNLINK", "EXISTS", "TOUCH":
+		return args[1:]
+	default:
+		if len(args) < 2 {
+			return nil
+		}
+		return args[1:2]
+	}
+}
+
+func (c *fakeCluster) ownedKeys(node int) []string {
+	var keys []string
+	for k := range c.keys {
+		if c.owner[hashSlot(k)] == node {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scanReply returns the owned keys two at a time, the cursor being the index
+// of the next key.
+func (c *fakeCluster) scanReply(node int, args []string) string {
+	keys := c.ownedKeys(node)
+	cursor, _ := strconv.Atoi(args[1])
+	end := cursor + 2
+	next := strconv.Itoa(end)
+	if end >= len(keys) {
+		end = len(keys)
+		next = "0"
+	}
+	var items []string
+	for _, k := range keys[cursor:end] {
+		items = append(items, respBulk(k))
+	}
+	return respArray(respBulk(next), respArray(items...))
+}
+
+// slotRanges returns the slot ranges of every node.
+func (c *fakeCluster) slotRanges() [][][2]int {
+	ranges := make([][][2]int, len(c.servers))
+	start := 0
+	for slot := 1; slot <= clusterSlotNum; slot++ {
+		if slot == clusterSlotNum || c.owner[slot] != c.owner[start] {
+			node := c.owner[start]
+			ranges[node] = append(ranges[node], [2]int{start, slot - 1})
+			start = slot
+		}
+	}
+	return ranges
+}
+
+func respBulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func respInt(n int) string {
+	return ":" + strconv.Itoa(n) + "\r\n"
+}
+
+func respArray(items ...string) string {
+	return "*" + strconv.Itoa(len(items)) + "\r\n" + strings.Join(items, "")
+}
+
+func (c *fakeCluster) shardsReply() string {
+	var shards []string
+	for node, ranges := range c.slotRanges() {
+		var slots []string
+		for _, r := range ranges {
+			slots = append(slots, respInt(r[0]), respInt(r[1]))
+		}
+		host, port, _ := net.SplitHostPort(c.servers[node].Addr())
+		p, _ := strconv.Atoi(port)
+		n := respArray(
+			respBulk("id"), respBulk(strconv.Itoa(node)),
+			respBulk("port"), respInt(p),
+			respBulk("ip"), respBulk(host),
+			respBulk("endpoint"), respBulk(host),
+			respBulk("role"), respBulk("master"),
+			respBulk("health"), respBulk("online"),
+		)
+		shards = append(shards, respArray(respBulk("slots"), respArray(slots...), respBulk("nodes"), respArray(n)))
+	}
+	return respArray(shards...)
+}
+
+func (c *fakeCluster) slotsReply() string {
+	var items []string
+	for node, ranges := range c.slotRanges() {
+		host, port, _ := net.SplitHostPort(c.servers[node].Addr())
+		p, _ := strconv.Atoi(port)
+		for _, r := range ranges {
+			items = append(items, respArray(respInt(r[0]), respInt(r[1]), respArray(respBulk(host), respInt(p), respBulk(strconv.Itoa(node)))))
+		}
+	}
+	return respArray(items...)
+}
+
+func TestHashSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	assert.Equal(t, 12182, hashSlot("foo"))
+	assert.Equal(t, hashSlot("user1000"), hashSlot("{user1000}.following"))
+	assert.Equal(t, hashSlot("{user1000}.followers"), hashSlot("{user1000}.following"))
+	// Only the first tag counts, and an empty tag hashes the whole key
+	assert.Equal(t, hashSlot("{bar"), hashSlot("foo{{bar}}zap"))
+	assert.Equal(t, hashSlot("foo{}{bar}"), int(crc16("foo{}{bar}")%clusterSlotNum))
+
+	slot, err := commandSlot(&stringMGetCommand{keys: []string{"{a}1", "{a}2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, hashSlot("a"), slot)
+	_, err = commandSlot(&stringMGetCommand{keys: []string{"a", "b"}})
+	assert.ErrorIs(t, err, ErrCrossSlot)
+	slot, err = commandSlot(&doCommand{args: []string{"PING"}})
+	assert.Nil(t, err)
+	assert.Equal(t, -1, slot)
+}
+
+func TestClusterClient(t *testing.T) {
+	for _, noShards := range []bool{false, true} {
+		cluster := newFakeCluster(t, 3)
+		cluster.noShards = noShards
+		cli, err := NewClusterClient(&ClusterConfig{ClientConfig: ClientConfig{Address: cluster.servers[1].Addr()}})
+		assert.Nil(t, err)
+		ctx := context.Background()
+
+		for i := 0; i < 20; i++ {
+			k := "key" + strconv.Itoa(i)
+			_, err := cli.Set(ctx, k, strconv.Itoa(i))
+			assert.Nil(t, err)
+			v, err := cli.Get(ctx, k)
+			assert.Nil(t, err)
+			assert.Equal(t, strconv.Itoa(i), *v)
+		}
+		state := cli.loadState()
+		assert.Equal(t, 3, len(state.shards))
+		assert.Equal(t, cluster.servers[0].Addr(), state.primary(0))
+		assert.Equal(t, cluster.servers[2].Addr(), state.primary(clusterSlotNum-1))
+		assert.Nil(t, cli.Close())
+	}
+}
+
+func TestClusterRedirect(t *testing.T) {
+	cluster := newFakeCluster(t, 2)
+	cli, err := NewClusterClient(&ClusterConfig{ClientConfig: ClientConfig{Address: cluster.servers[0].Addr()}})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	key := "foo"
+	slot := hashSlot(key)
+	_, err = cli.Set(ctx, key, "v")
+	assert.Nil(t, err)
+	owner := cli.loadState().primary(slot)
+	assert.Equal(t, cluster.servers[1].Addr(), owner)
+
+	// ASK during a migration: the command is sent again with ASKING without
+	// changing the slot map
+	cluster.migrate(slot, 0)
+	v, err := cli.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+	commands := cluster.Commands()
+	assert.Equal(t, []string{"1 GET foo", "0 ASKING", "0 GET foo"}, commands[len(commands)-3:])
+	assert.Equal(t, owner, cli.loadState().primary(slot))
+
+	// MOVED once the migration is done, the slot map is refreshed
+	cluster.mutex.Lock()
+	delete(cluster.migrating, slot)
+	cluster.mutex.Unlock()
+	cluster.setOwner(slot, 0)
+	v, err = cli.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+	assert.Eventually(t, func() bool {
+		return cli.loadState().primary(slot) == cluster.servers[0].Addr()
+	}, time.Second, time.Millisecond)
+}
+
+func TestClusterPipeline(t *testing.T) {
+	cluster := newFakeCluster(t, 3)
+	cli, err := NewClusterClient(&ClusterConfig{ClientConfig: ClientConfig{Address: cluster.servers[0].Addr()}})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	pipe := cli.Pipeline()
+	for i := 0; i < 30; i++ {
+		pipe.Set("key"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	_, err = pipe.Exec(ctx)
+	assert.Nil(t, err)
+
+	// Move a slot and migrate another one behind the back of the client
+	moved, asked := hashSlot("key1"), hashSlot("key2")
+	cluster.setOwner(moved, (cluster.owner[moved]+1)%3)
+	cluster.migrate(asked, (cluster.owner[asked]+1)%3)
+
+	pipe = cli.Pipeline()
+	for i := 0; i < 30; i++ {
+		pipe.Get("key" + strconv.Itoa(i))
+	}
+	pipe.Incr("counter")
+	res, err := pipe.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 31, len(res))
+	for i := 0; i < 30; i++ {
+		assert.Equal(t, strconv.Itoa(i), *res[i].(*string))
+	}
+	assert.Equal(t, int64(1), res[30])
+
+	// A command whose keys are in different slots fails the pipeline
+	pipe = cli.Pipeline()
+	pipe.Get("key1")
+	pipe.Lcs("key1", "key2")
+	_, err = pipe.Exec(ctx)
+	assert.ErrorIs(t, err, ErrCrossSlot)
+}
+
+func TestClusterMultiKey(t *testing.T) {
+	cluster := newFakeCluster(t, 3)
+	cli, err := NewClusterClient(&ClusterConfig{ClientConfig: ClientConfig{Address: cluster.servers[0].Addr()}})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	kvs := map[string]string{}
+	var keys []string
+	for i := 0; i < 10; i++ {
+		k := "key" + strconv.Itoa(i)
+		kvs[k] = strconv.Itoa(i)
+		keys = append(keys, k)
+	}
+	assert.Nil(t, cli.MSet(ctx, kvs))
+
+	res, err := cli.MGet(ctx, append(keys, "missing")...)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(res))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, strconv.Itoa(i), *res[i])
+	}
+	assert.Nil(t, res[10])
+
+	n, err := cli.Exists(ctx, "key1", "key2", "missing", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = cli.Touch(ctx, "key1", "key2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = cli.Del(ctx, "key1", "key2", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = cli.Unlink(ctx, keys...)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), n)
+
+	// MSETNX can't be atomic across slots
+	_, err = cli.MSetNX(ctx, map[string]string{"a": "1", "b": "2"})
+	assert.ErrorIs(t, err, ErrCrossSlot)
+}
+
+func TestClusterForEach(t *testing.T) {
+	cluster := newFakeCluster(t, 3)
+	cli, err := NewClusterClient(&ClusterConfig{ClientConfig: ClientConfig{Address: cluster.servers[0].Addr()}})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		k := "key" + strconv.Itoa(i)
+		keys = append(keys, k)
+		_, err := cli.Set(ctx, k, "v")
+		assert.Nil(t, err)
+	}
+
+	var mutex sync.Mutex
+	var size int64
+	err = cli.ForEachPrimary(ctx, func(ctx context.Context, addr string, node Client) error {
+		r, err := node.Do(ctx, "DBSIZE")
+		if err != nil {
+			return err
+		}
+		mutex.Lock()
+		size += r.(int64)
+		mutex.Unlock()
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), size)
+
+	failed := cluster.servers[1].Addr()
+	err = cli.ForEachNode(ctx, func(ctx context.Context, addr string, node Client) error {
+		_, err := node.Do(ctx, "FLUSHDB")
+		if addr != failed {
+			return nil
+		}
+		return err
+	})
+	var clusterErr *ClusterError
+	assert.ErrorAs(t, err, &clusterErr)
+	assert.Equal(t, 1, len(clusterErr.Errors))
+	assert.ErrorAs(t, clusterErr.Errors[failed], &Error{})
+	assert.Contains(t, err.Error(), failed)
+
+	_, err = cli.Scan(ctx, 0)
+	assert.ErrorIs(t, err, ErrGodis)
+
+	var scanned []string
+	it := cli.ScanIterator(MATCHArg("key*"), COUNTArg(2))
+	for it.Next(ctx) {
+		scanned = append(scanned, it.Key())
+	}
+	assert.Nil(t, it.Err())
+	sort.Strings(keys)
+	sort.Strings(scanned)
+	assert.Equal(t, keys, scanned)
+
+	// A failed primary is skipped and reported
+	cluster.servers[2].Close()
+	node, err := cli.node(cluster.servers[2].Addr())
+	assert.Nil(t, err)
+	assert.Nil(t, node.Close())
+	scanned = nil
+	it = cli.ScanIterator()
+	for it.Next(ctx) {
+		scanned = append(scanned, it.Key())
+	}
+	assert.ErrorAs(t, it.Err(), &clusterErr)
+	assert.Equal(t, 1, len(clusterErr.Errors))
+	assert.NotNil(t, clusterErr.Errors[cluster.servers[2].Addr()])
+	assert.Equal(t, len(cluster.ownedKeys(0))+len(cluster.ownedKeys(1)), len(scanned))
+}
+
+func TestDoCommandKeys(t *testing.T) {
+	assert.Equal(t, []string{"k"}, commandKeys(&doCommand{args: []string{"get", "k"}}))
+	assert.Nil(t, commandKeys(&doCommand{args: []string{"INFO", "server"}}))
+	assert.Nil(t, commandKeys(&doCommand{args: []string{"CONFIG", "GET", "maxmemory"}}))
+	assert.Nil(t, commandKeys(&doCommand{args: []string{"EVAL", "return 1", "1", "k"}}))
+}
+
+func TestClusterKeepsSeedNode(t *testing.T) {
+	cluster := newFakeCluster(t, 2)
+	_, port, _ := net.SplitHostPort(cluster.servers[0].Addr())
+	seed := "localhost:" + port
+	cli, err := NewClusterClient(&ClusterConfig{ClientConfig: ClientConfig{Address: seed}})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	_, err = cli.Do(ctx, "INFO", "server")
+	assert.Nil(t, err)
+	node, err := cli.node(seed)
+	assert.Nil(t, err)
+	assert.Nil(t, cli.refresh(ctx))
+	same, err := cli.node(seed)
+	assert.Nil(t, err)
+	assert.Same(t, node, same)
+	_, err = node.Do(ctx, "PING")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,467 @@
+// Command gencommands generates the commands of godis from commands.json, so
+// that the command structs, the methods of the clients and the methods of
+// Pipeline and ChunkedPipeline can't drift apart.
+//
+// Each command of the spec lists its request, made of literal tokens and of
+// arguments, in the order they are sent. The arguments of type key, keys and
+// kvs are the keys of the command, used to route it in cluster mode. The
+// reply names one of the reply kinds of the spec, which gives the Go type of
+// the result, the reader of the reply and the typed pipeline result.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+type spec struct {
+	Replies map[string]*reply `json:"replies"`
+	Groups  []*group          `json:"groups"`
+}
+
+type reply struct {
+	// The Go type of the result, empty for the commands only returning an
+	// error.
+	Type string `json:"type"`
+	Zero string `json:"zero"`
+	// The typed result returned by Pipeline.
+	Future string `json:"future"`
+	// The expression reading the reply, with ctx and protocol in scope.
+	Read string `json:"read"`
+}
+
+type group struct {
+	// The prefix of the command structs.
+	Name     string     `json:"name"`
+	Title    string     `json:"title"`
+	Commands []*command `json:"commands"`
+}
+
+type command struct {
+	Name    string     `json:"name"`
+	Request []*element `json:"request"`
+	Reply   string     `json:"reply"`
+	// The order of the arguments in the method signatures, the order of the
+	// request by default.
+	Params     []string `json:"params"`
+	ReadOnly   bool     `json:"readOnly"`
+	Idempotent bool     `json:"idempotent"`
+	// The function merging the results of a multi-key command split by slot.
+	// The command is split only if it is set.
+	Merge string `json:"merge"`
+}
+
+type element struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	// The name of the method parameter, Name by default.
+	Param string `json:"param"`
+}
+
+func (e *element) param() string {
+	if e.Param != "" {
+		return e.Param
+	}
+	return e.Name
+}
+
+func (e *element) isKey() bool {
+	return e.Type == "key" || e.Type == "keys" || e.Type == "kvs"
+}
+
+// goType returns the type of the struct field of e.
+func (e *element) goType() string {
+	switch e.Type {
+	case "key", "string":
+		return "string"
+	case "keys":
+		return "[]string"
+	case "kvs":
+		return "map[string]string"
+	case "args":
+		return "[]arg"
+	case "int", "int64", "uint", "uint64", "float64":
+		return e.Type
+	}
+	log.Fatalf("unknown argument type %q of %s", e.Type, e.Name)
+	return ""
+}
+
+// paramType returns the type of the method parameter of e.
+func (e *element) paramType() string {
+	switch e.Type {
+	case "keys":
+		return "...string"
+	case "args":
+		return "...arg"
+	}
+	return e.goType()
+}
+
+// format returns the expression formatting a scalar argument.
+func (e *element) format() string {
+	field := "c." + e.Name
+	switch e.Type {
+	case "key", "string":
+		return field
+	case "int":
+		return "strconv.Itoa(" + field + ")"
+	case "int64":
+		return "strconv.FormatInt(" + field + ", 10)"
+	case "uint":
+		return "strconv.FormatUint(uint64(" + field + "), 10)"
+	case "uint64":
+		return "strconv.FormatUint(" + field + ", 10)"
+	case "float64":
+		return "strconv.FormatFloat(" + field + ", 'f', -1, 64)"
+	}
+	log.Fatalf("argument %s of type %q is not a scalar", e.Name, e.Type)
+	return ""
+}
+
+func main() {
+	specPath := flag.String("spec", "commands.json", "the spec of the commands")
+	out := flag.String("out", "commands_gen.go", "the generated file")
+	flag.Parse()
+
+	src, err := generate(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(specPath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(specPath)
+	if err != nil {
+		return nil, err
+	}
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	g := &generator{spec: &s}
+	g.file()
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %w\n%s", err, g.buf.String())
+	}
+	return src, nil
+}
+
+type generator struct {
+	spec *spec
+	buf  bytes.Buffer
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format+"\n", args...)
+}
+
+func (g *generator) reply(cmd *command) *reply {
+	r, ok := g.spec.Replies[cmd.Reply]
+	if !ok {
+		log.Fatalf("unknown reply %q of %s", cmd.Reply, cmd.Name)
+	}
+	return r
+}
+
+func (g *generator) file() {
+	g.commandsInterface()
+	for _, grp := range g.spec.Groups {
+		for _, cmd := range grp.Commands {
+			g.command(grp, cmd)
+		}
+	}
+	body := g.buf.String()
+
+	g.buf.Reset()
+	g.p("// Code generated by gencommands from commands.json. DO NOT EDIT.")
+	g.p("")
+	g.p("package godis")
+	g.p("")
+	g.p("import (")
+	g.p("\t\"context\"")
+	if strings.Contains(body, "strconv.") {
+		g.p("\t\"strconv\"")
+	}
+	g.p(")")
+	g.buf.WriteString(body)
+}
+
+// commandsInterface declares the methods of the commands, implemented by
+// every client.
+func (g *generator) commandsInterface() {
+	g.p("")
+	g.p("// Commands are the commands sent by every client.")
+	g.p("type Commands interface {")
+	for i, grp := range g.spec.Groups {
+		if i > 0 {
+			g.p("")
+		}
+		g.p("// %s", grp.Title)
+		for _, cmd := range grp.Commands {
+			g.p("%s(ctx context.Context%s) %s", cmd.Name, g.params(cmd, true), g.results(cmd))
+		}
+	}
+	g.p("}")
+}
+
+func (g *generator) params(cmd *command, withCtx bool) string {
+	var params []string
+	for _, e := range g.orderedParams(cmd) {
+		params = append(params, e.param()+" "+e.paramType())
+	}
+	s := strings.Join(params, ", ")
+	if withCtx && s != "" {
+		return ", " + s
+	}
+	return s
+}
+
+// args returns the parameters of cmd passed on to another method.
+func (g *generator) args(cmd *command) string {
+	var args []string
+	for _, e := range g.orderedParams(cmd) {
+		arg := e.param()
+		if strings.HasPrefix(e.paramType(), "...") {
+			arg += "..."
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, ", ")
+}
+
+func (g *generator) orderedParams(cmd *command) []*element {
+	var args []*element
+	byName := map[string]*element{}
+	for _, e := range cmd.Request {
+		if e.Token == "" {
+			args = append(args, e)
+			byName[e.Name] = e
+		}
+	}
+	if cmd.Params == nil {
+		return args
+	}
+	if len(cmd.Params) != len(args) {
+		log.Fatalf("params of %s don't match its arguments", cmd.Name)
+	}
+	ordered := make([]*element, 0, len(args))
+	for _, name := range cmd.Params {
+		e, ok := byName[name]
+		if !ok {
+			log.Fatalf("unknown param %s of %s", name, cmd.Name)
+		}
+		ordered = append(ordered, e)
+	}
+	return ordered
+}
+
+func (g *generator) results(cmd *command) string {
+	r := g.reply(cmd)
+	if r.Type == "" {
+		return "error"
+	}
+	return "(" + r.Type + ", error)"
+}
+
+func structName(grp *group, cmd *command) string {
+	return grp.Name + cmd.Name + "Command"
+}
+
+// literal returns the composite literal of the command struct built from the
+// method parameters.
+func literal(grp *group, cmd *command) string {
+	var fields []string
+	for _, e := range cmd.Request {
+		if e.Token == "" {
+			fields = append(fields, e.Name+": "+e.param())
+		}
+	}
+	return "&" + structName(grp, cmd) + "{" + strings.Join(fields, ", ") + "}"
+}
+
+func (g *generator) command(grp *group, cmd *command) {
+	name := structName(grp, cmd)
+	r := g.reply(cmd)
+
+	g.p("")
+	g.p("type %s struct {", name)
+	if cmd.Idempotent {
+		g.p("idempotent")
+	}
+	if cmd.ReadOnly {
+		g.p("readOnly")
+	}
+	for _, e := range cmd.Request {
+		if e.Token == "" {
+			g.p("%s %s", e.Name, e.goType())
+		}
+	}
+	g.p("}")
+
+	g.keys(name, cmd)
+	g.sendReq(name, cmd)
+
+	g.p("")
+	g.p("func (c *%s) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {", name)
+	g.p("return %s", r.Read)
+	g.p("}")
+
+	if cmd.Merge != "" {
+		g.multiKey(name, cmd)
+	}
+
+	g.p("")
+	g.p("func (c cmdable) %s(ctx context.Context%s) %s {", cmd.Name, g.params(cmd, true), g.results(cmd))
+	g.p("cmd := %s", literal(grp, cmd))
+	if r.Type == "" {
+		g.p("_, err := c(ctx, cmd)")
+		g.p("return err")
+	} else {
+		g.p("res, err := c(ctx, cmd)")
+		g.p("if err != nil {")
+		g.p("return %s, err", r.Zero)
+		g.p("}")
+		g.p("return res.(%s), nil", r.Type)
+	}
+	g.p("}")
+
+	g.p("")
+	g.p("func (p *Pipeline) %s(%s) *%s {", cmd.Name, g.params(cmd, false), r.Future)
+	g.p("res := &%s{}", r.Future)
+	g.p("p.add(%s, res)", literal(grp, cmd))
+	g.p("return res")
+	g.p("}")
+
+	g.p("")
+	g.p("func (p *ChunkedPipeline) %s(ctx context.Context%s) *%s {", cmd.Name, g.params(cmd, true), r.Future)
+	g.p("res := p.queue.%s(%s)", cmd.Name, g.args(cmd))
+	g.p("p.send(ctx)")
+	g.p("return res")
+	g.p("}")
+}
+
+func (g *generator) keys(name string, cmd *command) {
+	var keys []*element
+	for _, e := range cmd.Request {
+		if e.isKey() {
+			keys = append(keys, e)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	g.p("")
+	g.p("func (c *%s) Keys() []string {", name)
+	switch {
+	case len(keys) == 1 && keys[0].Type == "keys":
+		g.p("return c.%s", keys[0].Name)
+	case len(keys) == 1 && keys[0].Type == "kvs":
+		g.p("keys := make([]string, 0, len(c.%s))", keys[0].Name)
+		g.p("for k := range c.%s {", keys[0].Name)
+		g.p("keys = append(keys, k)")
+		g.p("}")
+		g.p("return keys")
+	default:
+		var fields []string
+		for _, e := range keys {
+			if e.Type != "key" {
+				log.Fatalf("%s mixes several kinds of keys", cmd.Name)
+			}
+			fields = append(fields, "c."+e.Name)
+		}
+		g.p("return []string{%s}", strings.Join(fields, ", "))
+	}
+	g.p("}")
+}
+
+func (g *generator) sendReq(name string, cmd *command) {
+	var scalars []string
+	var rest []*element
+	optArgs := "nil"
+	for i, e := range cmd.Request {
+		if e.Type == "args" {
+			if i != len(cmd.Request)-1 {
+				log.Fatalf("the optional arguments of %s must be last", cmd.Name)
+			}
+			optArgs = "c." + e.Name
+			continue
+		}
+		if len(rest) > 0 || e.Type == "keys" || e.Type == "kvs" {
+			rest = append(rest, e)
+			continue
+		}
+		if e.Token != "" {
+			scalars = append(scalars, fmt.Sprintf("%q", e.Token))
+		} else {
+			scalars = append(scalars, e.format())
+		}
+	}
+
+	g.p("")
+	g.p("func (c *%s) SendReq(ctx context.Context, protocol Protocol) error {", name)
+	if len(rest) == 0 {
+		g.p("return sendReq(ctx, protocol, []string{%s}, %s)", strings.Join(scalars, ", "), optArgs)
+		g.p("}")
+		return
+	}
+	g.p("req := []string{%s}", strings.Join(scalars, ", "))
+	for _, e := range rest {
+		switch {
+		case e.Token != "":
+			g.p("req = append(req, %q)", e.Token)
+		case e.Type == "keys":
+			g.p("req = append(req, c.%s...)", e.Name)
+		case e.Type == "kvs":
+			g.p("for k, v := range c.%s {", e.Name)
+			g.p("req = append(req, k, v)")
+			g.p("}")
+		default:
+			g.p("req = append(req, %s)", e.format())
+		}
+	}
+	g.p("return sendReq(ctx, protocol, req, %s)", optArgs)
+	g.p("}")
+}
+
+// multiKey implements multiKeyCommand for a command whose keys are its only
+// argument.
+func (g *generator) multiKey(name string, cmd *command) {
+	var keys *element
+	for _, e := range cmd.Request {
+		if e.Token != "" {
+			continue
+		}
+		if keys != nil || (e.Type != "keys" && e.Type != "kvs") {
+			log.Fatalf("%s can't be split by slot, its only argument must be keys", cmd.Name)
+		}
+		keys = e
+	}
+	g.p("")
+	g.p("func (c *%s) withKeys(keys []string) Command {", name)
+	if keys.Type == "keys" {
+		g.p("return &%s{%s: keys}", name, keys.Name)
+	} else {
+		g.p("kvs := make(map[string]string, len(keys))")
+		g.p("for _, k := range keys {")
+		g.p("kvs[k] = c.%s[k]", keys.Name)
+		g.p("}")
+		g.p("return &%s{%s: kvs}", name, keys.Name)
+	}
+	g.p("}")
+	g.p("")
+	g.p("func (c *%s) merge(indexes [][]int, results []interface{}) interface{} {", name)
+	g.p("return %s(indexes, results)", cmd.Merge)
+	g.p("}")
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratedCommandsUpToDate(t *testing.T) {
+	src, err := generate("../../commands.json")
+	assert.Nil(t, err)
+	gen, err := ioutil.ReadFile("../../commands_gen.go")
+	assert.Nil(t, err)
+	assert.Equal(t, string(gen), string(src), "commands_gen.go is stale, run go generate")
+}
@@ -0,0 +1,1275 @@
+// Code generated by gencommands from commands.json. DO NOT EDIT.
+
+package godis
+
+import (
+	"context"
+	"strconv"
+)
+
+// Commands are the commands sent by every client.
+type Commands interface {
+	// Generic
+	Del(ctx context.Context, keys ...string) (int64, error)
+	Exists(ctx context.Context, keys ...string) (int64, error)
+	Scan(ctx context.Context, cursor uint64, args ...arg) (ScanRes, error)
+	Touch(ctx context.Context, keys ...string) (int64, error)
+	Unlink(ctx context.Context, keys ...string) (int64, error)
+
+	// String
+	Append(ctx context.Context, key string, value string) (int64, error)
+	Decr(ctx context.Context, key string) (int64, error)
+	DecrBy(ctx context.Context, key string, decrement int64) (int64, error)
+	Get(ctx context.Context, key string) (*string, error)
+	GetDel(ctx context.Context, key string) (*string, error)
+	GetEX(ctx context.Context, key string, optArgs ...arg) (*string, error)
+	GetRange(ctx context.Context, key string, start int64, end int64) (string, error)
+	GetSet(ctx context.Context, key string, value string) (*string, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	IncrBy(ctx context.Context, key string, increment int64) (int64, error)
+	IncrByFloat(ctx context.Context, key string, increment float64) (float64, error)
+	Lcs(ctx context.Context, key1 string, key2 string, args ...arg) (string, error)
+	LcsIdx(ctx context.Context, key1 string, key2 string, args ...arg) (LcsIdxRes, error)
+	LcsIdxWithMatchLen(ctx context.Context, key1 string, key2 string, args ...arg) (LcsIdxRes, error)
+	LcsLen(ctx context.Context, key1 string, key2 string) (int64, error)
+	MGet(ctx context.Context, keys ...string) ([]*string, error)
+	MSet(ctx context.Context, kvs map[string]string) error
+	MSetNX(ctx context.Context, kvs map[string]string) (bool, error)
+	PSetEX(ctx context.Context, key string, value string, milliseconds uint64) error
+	Set(ctx context.Context, key string, value string, optArgs ...arg) (bool, error)
+	SetEX(ctx context.Context, key string, value string, seconds uint64) error
+	SetNX(ctx context.Context, key string, value string) (bool, error)
+	SetRange(ctx context.Context, key string, offset uint, value string) (uint, error)
+	StrLen(ctx context.Context, key string) (uint, error)
+	SubStr(ctx context.Context, key string, start int, end int) (string, error)
+}
+
+type genericDelCommand struct {
+	keys []string
+}
+
+func (c *genericDelCommand) Keys() []string {
+	return c.keys
+}
+
+func (c *genericDelCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"DEL"}
+	req = append(req, c.keys...)
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *genericDelCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c *genericDelCommand) withKeys(keys []string) Command {
+	return &genericDelCommand{keys: keys}
+}
+
+func (c *genericDelCommand) merge(indexes [][]int, results []interface{}) interface{} {
+	return sumIntegers(indexes, results)
+}
+
+func (c cmdable) Del(ctx context.Context, keys ...string) (int64, error) {
+	cmd := &genericDelCommand{keys: keys}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Del(keys ...string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&genericDelCommand{keys: keys}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Del(ctx context.Context, keys ...string) *IntCmd {
+	res := p.queue.Del(keys...)
+	p.send(ctx)
+	return res
+}
+
+type genericExistsCommand struct {
+	idempotent
+	readOnly
+	keys []string
+}
+
+func (c *genericExistsCommand) Keys() []string {
+	return c.keys
+}
+
+func (c *genericExistsCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"EXISTS"}
+	req = append(req, c.keys...)
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *genericExistsCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c *genericExistsCommand) withKeys(keys []string) Command {
+	return &genericExistsCommand{keys: keys}
+}
+
+func (c *genericExistsCommand) merge(indexes [][]int, results []interface{}) interface{} {
+	return sumIntegers(indexes, results)
+}
+
+func (c cmdable) Exists(ctx context.Context, keys ...string) (int64, error) {
+	cmd := &genericExistsCommand{keys: keys}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Exists(keys ...string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&genericExistsCommand{keys: keys}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Exists(ctx context.Context, keys ...string) *IntCmd {
+	res := p.queue.Exists(keys...)
+	p.send(ctx)
+	return res
+}
+
+type genericScanCommand struct {
+	idempotent
+	cursor uint64
+	args   []arg
+}
+
+func (c *genericScanCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"SCAN", strconv.FormatUint(c.cursor, 10)}, c.args)
+}
+
+func (c *genericScanCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readScanRes(ctx, protocol)
+}
+
+func (c cmdable) Scan(ctx context.Context, cursor uint64, args ...arg) (ScanRes, error) {
+	cmd := &genericScanCommand{cursor: cursor, args: args}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return ScanRes{}, err
+	}
+	return res.(ScanRes), nil
+}
+
+func (p *Pipeline) Scan(cursor uint64, args ...arg) *ScanCmd {
+	res := &ScanCmd{}
+	p.add(&genericScanCommand{cursor: cursor, args: args}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Scan(ctx context.Context, cursor uint64, args ...arg) *ScanCmd {
+	res := p.queue.Scan(cursor, args...)
+	p.send(ctx)
+	return res
+}
+
+type genericTouchCommand struct {
+	idempotent
+	readOnly
+	keys []string
+}
+
+func (c *genericTouchCommand) Keys() []string {
+	return c.keys
+}
+
+func (c *genericTouchCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"TOUCH"}
+	req = append(req, c.keys...)
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *genericTouchCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c *genericTouchCommand) withKeys(keys []string) Command {
+	return &genericTouchCommand{keys: keys}
+}
+
+func (c *genericTouchCommand) merge(indexes [][]int, results []interface{}) interface{} {
+	return sumIntegers(indexes, results)
+}
+
+func (c cmdable) Touch(ctx context.Context, keys ...string) (int64, error) {
+	cmd := &genericTouchCommand{keys: keys}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Touch(keys ...string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&genericTouchCommand{keys: keys}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Touch(ctx context.Context, keys ...string) *IntCmd {
+	res := p.queue.Touch(keys...)
+	p.send(ctx)
+	return res
+}
+
+type genericUnlinkCommand struct {
+	keys []string
+}
+
+func (c *genericUnlinkCommand) Keys() []string {
+	return c.keys
+}
+
+func (c *genericUnlinkCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"UNLINK"}
+	req = append(req, c.keys...)
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *genericUnlinkCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c *genericUnlinkCommand) withKeys(keys []string) Command {
+	return &genericUnlinkCommand{keys: keys}
+}
+
+func (c *genericUnlinkCommand) merge(indexes [][]int, results []interface{}) interface{} {
+	return sumIntegers(indexes, results)
+}
+
+func (c cmdable) Unlink(ctx context.Context, keys ...string) (int64, error) {
+	cmd := &genericUnlinkCommand{keys: keys}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Unlink(keys ...string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&genericUnlinkCommand{keys: keys}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Unlink(ctx context.Context, keys ...string) *IntCmd {
+	res := p.queue.Unlink(keys...)
+	p.send(ctx)
+	return res
+}
+
+type stringAppendCommand struct {
+	key   string
+	value string
+}
+
+func (c *stringAppendCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringAppendCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"APPEND", c.key, c.value}, nil)
+}
+
+func (c *stringAppendCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c cmdable) Append(ctx context.Context, key string, value string) (int64, error) {
+	cmd := &stringAppendCommand{key: key, value: value}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Append(key string, value string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&stringAppendCommand{key: key, value: value}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Append(ctx context.Context, key string, value string) *IntCmd {
+	res := p.queue.Append(key, value)
+	p.send(ctx)
+	return res
+}
+
+type stringDecrCommand struct {
+	key string
+}
+
+func (c *stringDecrCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringDecrCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"DECR", c.key}, nil)
+}
+
+func (c *stringDecrCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c cmdable) Decr(ctx context.Context, key string) (int64, error) {
+	cmd := &stringDecrCommand{key: key}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Decr(key string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&stringDecrCommand{key: key}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Decr(ctx context.Context, key string) *IntCmd {
+	res := p.queue.Decr(key)
+	p.send(ctx)
+	return res
+}
+
+type stringDecrByCommand struct {
+	key       string
+	decrement int64
+}
+
+func (c *stringDecrByCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringDecrByCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"DECRBY", c.key, strconv.FormatInt(c.decrement, 10)}, nil)
+}
+
+func (c *stringDecrByCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c cmdable) DecrBy(ctx context.Context, key string, decrement int64) (int64, error) {
+	cmd := &stringDecrByCommand{key: key, decrement: decrement}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) DecrBy(key string, decrement int64) *IntCmd {
+	res := &IntCmd{}
+	p.add(&stringDecrByCommand{key: key, decrement: decrement}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) DecrBy(ctx context.Context, key string, decrement int64) *IntCmd {
+	res := p.queue.DecrBy(key, decrement)
+	p.send(ctx)
+	return res
+}
+
+type stringGetCommand struct {
+	idempotent
+	readOnly
+	key string
+}
+
+func (c *stringGetCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringGetCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"GET", c.key}, nil)
+}
+
+func (c *stringGetCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readRespStringOrNil(ctx, protocol)
+}
+
+func (c cmdable) Get(ctx context.Context, key string) (*string, error) {
+	cmd := &stringGetCommand{key: key}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*string), nil
+}
+
+func (p *Pipeline) Get(key string) *NullStringCmd {
+	res := &NullStringCmd{}
+	p.add(&stringGetCommand{key: key}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Get(ctx context.Context, key string) *NullStringCmd {
+	res := p.queue.Get(key)
+	p.send(ctx)
+	return res
+}
+
+type stringGetDelCommand struct {
+	key string
+}
+
+func (c *stringGetDelCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringGetDelCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"GETDEL", c.key}, nil)
+}
+
+func (c *stringGetDelCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readRespStringOrNil(ctx, protocol)
+}
+
+func (c cmdable) GetDel(ctx context.Context, key string) (*string, error) {
+	cmd := &stringGetDelCommand{key: key}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*string), nil
+}
+
+func (p *Pipeline) GetDel(key string) *NullStringCmd {
+	res := &NullStringCmd{}
+	p.add(&stringGetDelCommand{key: key}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) GetDel(ctx context.Context, key string) *NullStringCmd {
+	res := p.queue.GetDel(key)
+	p.send(ctx)
+	return res
+}
+
+type stringGetEXCommand struct {
+	idempotent
+	key  string
+	args []arg
+}
+
+func (c *stringGetEXCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringGetEXCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"GETEX", c.key}, c.args)
+}
+
+func (c *stringGetEXCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readRespStringOrNil(ctx, protocol)
+}
+
+func (c cmdable) GetEX(ctx context.Context, key string, optArgs ...arg) (*string, error) {
+	cmd := &stringGetEXCommand{key: key, args: optArgs}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*string), nil
+}
+
+func (p *Pipeline) GetEX(key string, optArgs ...arg) *NullStringCmd {
+	res := &NullStringCmd{}
+	p.add(&stringGetEXCommand{key: key, args: optArgs}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) GetEX(ctx context.Context, key string, optArgs ...arg) *NullStringCmd {
+	res := p.queue.GetEX(key, optArgs...)
+	p.send(ctx)
+	return res
+}
+
+type stringGetRangeCommand struct {
+	idempotent
+	readOnly
+	key   string
+	start int64
+	end   int64
+}
+
+func (c *stringGetRangeCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringGetRangeCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"GETRANGE", c.key, strconv.FormatInt(c.start, 10), strconv.FormatInt(c.end, 10)}, nil)
+}
+
+func (c *stringGetRangeCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readString(ctx, protocol)
+}
+
+func (c cmdable) GetRange(ctx context.Context, key string, start int64, end int64) (string, error) {
+	cmd := &stringGetRangeCommand{key: key, start: start, end: end}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return res.(string), nil
+}
+
+func (p *Pipeline) GetRange(key string, start int64, end int64) *StringCmd {
+	res := &StringCmd{}
+	p.add(&stringGetRangeCommand{key: key, start: start, end: end}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) GetRange(ctx context.Context, key string, start int64, end int64) *StringCmd {
+	res := p.queue.GetRange(key, start, end)
+	p.send(ctx)
+	return res
+}
+
+type stringGetSetCommand struct {
+	key   string
+	value string
+}
+
+func (c *stringGetSetCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringGetSetCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"GETSET", c.key, c.value}, nil)
+}
+
+func (c *stringGetSetCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readRespStringOrNil(ctx, protocol)
+}
+
+func (c cmdable) GetSet(ctx context.Context, key string, value string) (*string, error) {
+	cmd := &stringGetSetCommand{key: key, value: value}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*string), nil
+}
+
+func (p *Pipeline) GetSet(key string, value string) *NullStringCmd {
+	res := &NullStringCmd{}
+	p.add(&stringGetSetCommand{key: key, value: value}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) GetSet(ctx context.Context, key string, value string) *NullStringCmd {
+	res := p.queue.GetSet(key, value)
+	p.send(ctx)
+	return res
+}
+
+type stringIncrCommand struct {
+	key string
+}
+
+func (c *stringIncrCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringIncrCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"INCR", c.key}, nil)
+}
+
+func (c *stringIncrCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c cmdable) Incr(ctx context.Context, key string) (int64, error) {
+	cmd := &stringIncrCommand{key: key}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) Incr(key string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&stringIncrCommand{key: key}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Incr(ctx context.Context, key string) *IntCmd {
+	res := p.queue.Incr(key)
+	p.send(ctx)
+	return res
+}
+
+type stringIncrByCommand struct {
+	key       string
+	increment int64
+}
+
+func (c *stringIncrByCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringIncrByCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"INCRBY", c.key, strconv.FormatInt(c.increment, 10)}, nil)
+}
+
+func (c *stringIncrByCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c cmdable) IncrBy(ctx context.Context, key string, increment int64) (int64, error) {
+	cmd := &stringIncrByCommand{key: key, increment: increment}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) IncrBy(key string, increment int64) *IntCmd {
+	res := &IntCmd{}
+	p.add(&stringIncrByCommand{key: key, increment: increment}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) IncrBy(ctx context.Context, key string, increment int64) *IntCmd {
+	res := p.queue.IncrBy(key, increment)
+	p.send(ctx)
+	return res
+}
+
+type stringIncrByFloatCommand struct {
+	key       string
+	increment float64
+}
+
+func (c *stringIncrByFloatCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringIncrByFloatCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"INCRBYFLOAT", c.key, strconv.FormatFloat(c.increment, 'f', -1, 64)}, nil)
+}
+
+func (c *stringIncrByFloatCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readFloat(ctx, protocol)
+}
+
+func (c cmdable) IncrByFloat(ctx context.Context, key string, increment float64) (float64, error) {
+	cmd := &stringIncrByFloatCommand{key: key, increment: increment}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(float64), nil
+}
+
+func (p *Pipeline) IncrByFloat(key string, increment float64) *FloatCmd {
+	res := &FloatCmd{}
+	p.add(&stringIncrByFloatCommand{key: key, increment: increment}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) IncrByFloat(ctx context.Context, key string, increment float64) *FloatCmd {
+	res := p.queue.IncrByFloat(key, increment)
+	p.send(ctx)
+	return res
+}
+
+type stringLcsCommand struct {
+	idempotent
+	readOnly
+	key1 string
+	key2 string
+	args []arg
+}
+
+func (c *stringLcsCommand) Keys() []string {
+	return []string{c.key1, c.key2}
+}
+
+func (c *stringLcsCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"LCS", c.key1, c.key2}, c.args)
+}
+
+func (c *stringLcsCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readString(ctx, protocol)
+}
+
+func (c cmdable) Lcs(ctx context.Context, key1 string, key2 string, args ...arg) (string, error) {
+	cmd := &stringLcsCommand{key1: key1, key2: key2, args: args}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return res.(string), nil
+}
+
+func (p *Pipeline) Lcs(key1 string, key2 string, args ...arg) *StringCmd {
+	res := &StringCmd{}
+	p.add(&stringLcsCommand{key1: key1, key2: key2, args: args}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Lcs(ctx context.Context, key1 string, key2 string, args ...arg) *StringCmd {
+	res := p.queue.Lcs(key1, key2, args...)
+	p.send(ctx)
+	return res
+}
+
+type stringLcsIdxCommand struct {
+	idempotent
+	readOnly
+	key1 string
+	key2 string
+	args []arg
+}
+
+func (c *stringLcsIdxCommand) Keys() []string {
+	return []string{c.key1, c.key2}
+}
+
+func (c *stringLcsIdxCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"LCS", c.key1, c.key2, "IDX"}, c.args)
+}
+
+func (c *stringLcsIdxCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readLcsIdxRes(ctx, protocol)
+}
+
+func (c cmdable) LcsIdx(ctx context.Context, key1 string, key2 string, args ...arg) (LcsIdxRes, error) {
+	cmd := &stringLcsIdxCommand{key1: key1, key2: key2, args: args}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return LcsIdxRes{}, err
+	}
+	return res.(LcsIdxRes), nil
+}
+
+func (p *Pipeline) LcsIdx(key1 string, key2 string, args ...arg) *LcsIdxCmd {
+	res := &LcsIdxCmd{}
+	p.add(&stringLcsIdxCommand{key1: key1, key2: key2, args: args}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) LcsIdx(ctx context.Context, key1 string, key2 string, args ...arg) *LcsIdxCmd {
+	res := p.queue.LcsIdx(key1, key2, args...)
+	p.send(ctx)
+	return res
+}
+
+type stringLcsIdxWithMatchLenCommand struct {
+	idempotent
+	readOnly
+	key1 string
+	key2 string
+	args []arg
+}
+
+func (c *stringLcsIdxWithMatchLenCommand) Keys() []string {
+	return []string{c.key1, c.key2}
+}
+
+func (c *stringLcsIdxWithMatchLenCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"LCS", c.key1, c.key2, "IDX", "WITHMATCHLEN"}, c.args)
+}
+
+func (c *stringLcsIdxWithMatchLenCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readLcsIdxRes(ctx, protocol)
+}
+
+func (c cmdable) LcsIdxWithMatchLen(ctx context.Context, key1 string, key2 string, args ...arg) (LcsIdxRes, error) {
+	cmd := &stringLcsIdxWithMatchLenCommand{key1: key1, key2: key2, args: args}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return LcsIdxRes{}, err
+	}
+	return res.(LcsIdxRes), nil
+}
+
+func (p *Pipeline) LcsIdxWithMatchLen(key1 string, key2 string, args ...arg) *LcsIdxCmd {
+	res := &LcsIdxCmd{}
+	p.add(&stringLcsIdxWithMatchLenCommand{key1: key1, key2: key2, args: args}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) LcsIdxWithMatchLen(ctx context.Context, key1 string, key2 string, args ...arg) *LcsIdxCmd {
+	res := p.queue.LcsIdxWithMatchLen(key1, key2, args...)
+	p.send(ctx)
+	return res
+}
+
+type stringLcsLenCommand struct {
+	idempotent
+	readOnly
+	key1 string
+	key2 string
+}
+
+func (c *stringLcsLenCommand) Keys() []string {
+	return []string{c.key1, c.key2}
+}
+
+func (c *stringLcsLenCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"LCS", c.key1, c.key2, "LEN"}, nil)
+}
+
+func (c *stringLcsLenCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return protocol.ReadInteger(ctx)
+}
+
+func (c cmdable) LcsLen(ctx context.Context, key1 string, key2 string) (int64, error) {
+	cmd := &stringLcsLenCommand{key1: key1, key2: key2}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (p *Pipeline) LcsLen(key1 string, key2 string) *IntCmd {
+	res := &IntCmd{}
+	p.add(&stringLcsLenCommand{key1: key1, key2: key2}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) LcsLen(ctx context.Context, key1 string, key2 string) *IntCmd {
+	res := p.queue.LcsLen(key1, key2)
+	p.send(ctx)
+	return res
+}
+
+type stringMGetCommand struct {
+	idempotent
+	readOnly
+	keys []string
+}
+
+func (c *stringMGetCommand) Keys() []string {
+	return c.keys
+}
+
+func (c *stringMGetCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"MGET"}
+	req = append(req, c.keys...)
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *stringMGetCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readNullStringSlice(ctx, protocol)
+}
+
+func (c *stringMGetCommand) withKeys(keys []string) Command {
+	return &stringMGetCommand{keys: keys}
+}
+
+func (c *stringMGetCommand) merge(indexes [][]int, results []interface{}) interface{} {
+	return mergeNullStrings(indexes, results)
+}
+
+func (c cmdable) MGet(ctx context.Context, keys ...string) ([]*string, error) {
+	cmd := &stringMGetCommand{keys: keys}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return res.([]*string), nil
+}
+
+func (p *Pipeline) MGet(keys ...string) *NullStringSliceCmd {
+	res := &NullStringSliceCmd{}
+	p.add(&stringMGetCommand{keys: keys}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) MGet(ctx context.Context, keys ...string) *NullStringSliceCmd {
+	res := p.queue.MGet(keys...)
+	p.send(ctx)
+	return res
+}
+
+type stringMSetCommand struct {
+	idempotent
+	kvs map[string]string
+}
+
+func (c *stringMSetCommand) Keys() []string {
+	keys := make([]string, 0, len(c.kvs))
+	for k := range c.kvs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (c *stringMSetCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"MSET"}
+	for k, v := range c.kvs {
+		req = append(req, k, v)
+	}
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *stringMSetCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readStatus(ctx, protocol, "OK")
+}
+
+func (c *stringMSetCommand) withKeys(keys []string) Command {
+	kvs := make(map[string]string, len(keys))
+	for _, k := range keys {
+		kvs[k] = c.kvs[k]
+	}
+	return &stringMSetCommand{kvs: kvs}
+}
+
+func (c *stringMSetCommand) merge(indexes [][]int, results []interface{}) interface{} {
+	return mergeNothing(indexes, results)
+}
+
+func (c cmdable) MSet(ctx context.Context, kvs map[string]string) error {
+	cmd := &stringMSetCommand{kvs: kvs}
+	_, err := c(ctx, cmd)
+	return err
+}
+
+func (p *Pipeline) MSet(kvs map[string]string) *StatusCmd {
+	res := &StatusCmd{}
+	p.add(&stringMSetCommand{kvs: kvs}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) MSet(ctx context.Context, kvs map[string]string) *StatusCmd {
+	res := p.queue.MSet(kvs)
+	p.send(ctx)
+	return res
+}
+
+type stringMSetNXCommand struct {
+	kvs map[string]string
+}
+
+func (c *stringMSetNXCommand) Keys() []string {
+	keys := make([]string, 0, len(c.kvs))
+	for k := range c.kvs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (c *stringMSetNXCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	req := []string{"MSETNX"}
+	for k, v := range c.kvs {
+		req = append(req, k, v)
+	}
+	return sendReq(ctx, protocol, req, nil)
+}
+
+func (c *stringMSetNXCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readBool(ctx, protocol)
+}
+
+func (c cmdable) MSetNX(ctx context.Context, kvs map[string]string) (bool, error) {
+	cmd := &stringMSetNXCommand{kvs: kvs}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+func (p *Pipeline) MSetNX(kvs map[string]string) *BoolCmd {
+	res := &BoolCmd{}
+	p.add(&stringMSetNXCommand{kvs: kvs}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) MSetNX(ctx context.Context, kvs map[string]string) *BoolCmd {
+	res := p.queue.MSetNX(kvs)
+	p.send(ctx)
+	return res
+}
+
+type stringPSetEXCommand struct {
+	idempotent
+	key          string
+	milliseconds uint64
+	value        string
+}
+
+func (c *stringPSetEXCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringPSetEXCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"PSETEX", c.key, strconv.FormatUint(c.milliseconds, 10), c.value}, nil)
+}
+
+func (c *stringPSetEXCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readStatus(ctx, protocol, "OK")
+}
+
+func (c cmdable) PSetEX(ctx context.Context, key string, value string, milliseconds uint64) error {
+	cmd := &stringPSetEXCommand{key: key, milliseconds: milliseconds, value: value}
+	_, err := c(ctx, cmd)
+	return err
+}
+
+func (p *Pipeline) PSetEX(key string, value string, milliseconds uint64) *StatusCmd {
+	res := &StatusCmd{}
+	p.add(&stringPSetEXCommand{key: key, milliseconds: milliseconds, value: value}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) PSetEX(ctx context.Context, key string, value string, milliseconds uint64) *StatusCmd {
+	res := p.queue.PSetEX(key, value, milliseconds)
+	p.send(ctx)
+	return res
+}
+
+type stringSetCommand struct {
+	key   string
+	value string
+	args  []arg
+}
+
+func (c *stringSetCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringSetCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"SET", c.key, c.value}, c.args)
+}
+
+func (c *stringSetCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readOKOrNil(ctx, protocol)
+}
+
+func (c cmdable) Set(ctx context.Context, key string, value string, optArgs ...arg) (bool, error) {
+	cmd := &stringSetCommand{key: key, value: value, args: optArgs}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+func (p *Pipeline) Set(key string, value string, optArgs ...arg) *BoolCmd {
+	res := &BoolCmd{}
+	p.add(&stringSetCommand{key: key, value: value, args: optArgs}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) Set(ctx context.Context, key string, value string, optArgs ...arg) *BoolCmd {
+	res := p.queue.Set(key, value, optArgs...)
+	p.send(ctx)
+	return res
+}
+
+type stringSetEXCommand struct {
+	idempotent
+	key     string
+	seconds uint64
+	value   string
+}
+
+func (c *stringSetEXCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringSetEXCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"SETEX", c.key, strconv.FormatUint(c.seconds, 10), c.value}, nil)
+}
+
+func (c *stringSetEXCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readStatus(ctx, protocol, "OK")
+}
+
+func (c cmdable) SetEX(ctx context.Context, key string, value string, seconds uint64) error {
+	cmd := &stringSetEXCommand{key: key, seconds: seconds, value: value}
+	_, err := c(ctx, cmd)
+	return err
+}
+
+func (p *Pipeline) SetEX(key string, value string, seconds uint64) *StatusCmd {
+	res := &StatusCmd{}
+	p.add(&stringSetEXCommand{key: key, seconds: seconds, value: value}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) SetEX(ctx context.Context, key string, value string, seconds uint64) *StatusCmd {
+	res := p.queue.SetEX(key, value, seconds)
+	p.send(ctx)
+	return res
+}
+
+type stringSetNXCommand struct {
+	key   string
+	value string
+}
+
+func (c *stringSetNXCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringSetNXCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"SETNX", c.key, c.value}, nil)
+}
+
+func (c *stringSetNXCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readBool(ctx, protocol)
+}
+
+func (c cmdable) SetNX(ctx context.Context, key string, value string) (bool, error) {
+	cmd := &stringSetNXCommand{key: key, value: value}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+func (p *Pipeline) SetNX(key string, value string) *BoolCmd {
+	res := &BoolCmd{}
+	p.add(&stringSetNXCommand{key: key, value: value}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) SetNX(ctx context.Context, key string, value string) *BoolCmd {
+	res := p.queue.SetNX(key, value)
+	p.send(ctx)
+	return res
+}
+
+type stringSetRangeCommand struct {
+	idempotent
+	key    string
+	offset uint
+	value  string
+}
+
+func (c *stringSetRangeCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringSetRangeCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"SETRANGE", c.key, strconv.FormatUint(uint64(c.offset), 10), c.value}, nil)
+}
+
+func (c *stringSetRangeCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readUint(ctx, protocol)
+}
+
+func (c cmdable) SetRange(ctx context.Context, key string, offset uint, value string) (uint, error) {
+	cmd := &stringSetRangeCommand{key: key, offset: offset, value: value}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(uint), nil
+}
+
+func (p *Pipeline) SetRange(key string, offset uint, value string) *UintCmd {
+	res := &UintCmd{}
+	p.add(&stringSetRangeCommand{key: key, offset: offset, value: value}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) SetRange(ctx context.Context, key string, offset uint, value string) *UintCmd {
+	res := p.queue.SetRange(key, offset, value)
+	p.send(ctx)
+	return res
+}
+
+type stringStrLenCommand struct {
+	idempotent
+	readOnly
+	key string
+}
+
+func (c *stringStrLenCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringStrLenCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"STRLEN", c.key}, nil)
+}
+
+func (c *stringStrLenCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readUint(ctx, protocol)
+}
+
+func (c cmdable) StrLen(ctx context.Context, key string) (uint, error) {
+	cmd := &stringStrLenCommand{key: key}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return res.(uint), nil
+}
+
+func (p *Pipeline) StrLen(key string) *UintCmd {
+	res := &UintCmd{}
+	p.add(&stringStrLenCommand{key: key}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) StrLen(ctx context.Context, key string) *UintCmd {
+	res := p.queue.StrLen(key)
+	p.send(ctx)
+	return res
+}
+
+type stringSubStrCommand struct {
+	idempotent
+	readOnly
+	key   string
+	start int
+	end   int
+}
+
+func (c *stringSubStrCommand) Keys() []string {
+	return []string{c.key}
+}
+
+func (c *stringSubStrCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"SUBSTR", c.key, strconv.Itoa(c.start), strconv.Itoa(c.end)}, nil)
+}
+
+func (c *stringSubStrCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readString(ctx, protocol)
+}
+
+func (c cmdable) SubStr(ctx context.Context, key string, start int, end int) (string, error) {
+	cmd := &stringSubStrCommand{key: key, start: start, end: end}
+	res, err := c(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return res.(string), nil
+}
+
+func (p *Pipeline) SubStr(key string, start int, end int) *StringCmd {
+	res := &StringCmd{}
+	p.add(&stringSubStrCommand{key: key, start: start, end: end}, res)
+	return res
+}
+
+func (p *ChunkedPipeline) SubStr(ctx context.Context, key string, start int, end int) *StringCmd {
+	res := p.queue.SubStr(key, start, end)
+	p.send(ctx)
+	return res
+}
@@ -0,0 +1,175 @@
+package godis
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Conn is a connection checked out of the pool for the exclusive use of one
+// goroutine. Commands changing the state of the connection, such as SELECT
+// or WATCH, apply to the commands sent after them on the same Conn. Commands
+// are neither retried nor automatically pipelined. CLIENT REPLY must be sent
+// with ClientReply, so that the commands sent while the replies are off don't
+// wait for one.
+//
+// Close must be called to give the connection back. It is reset with RESET
+// first, or discarded if that fails, so that its state never leaks into the
+// pool.
+type Conn struct {
+	cmdable
+	client *client
+	con    Connection
+	closed bool
+	// The mode set by ClientReply, empty when the replies are on.
+	replyMode string
+}
+
+func (c *client) Conn(ctx context.Context) (*Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := c.conPool.(*multiplexPool); ok {
+		return nil, errors.Wrap(ErrGodis, "dedicated connections are not supported in multiplexed mode")
+	}
+	con, err := c.conPool.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+	conn := &Conn{client: c, con: con}
+	conn.cmdable = conn.exec
+	return conn, nil
+}
+
+func (c *Conn) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if c.replyMode == "" {
+		return c.send(ctx, cmd, true)
+	}
+	if c.replyMode == "SKIP" {
+		c.replyMode = ""
+	}
+	return c.send(ctx, cmd, false)
+}
+
+// send sends cmd and reads its reply if reply is set, otherwise it returns
+// ErrNoReply.
+func (c *Conn) send(ctx context.Context, cmd Command, reply bool) (interface{}, error) {
+	if c.closed {
+		return nil, ErrClosedConn
+	}
+	protocol := c.client.newProtocol(c.con)
+	if err := cmd.SendReq(ctx, protocol); err != nil {
+		c.con.SetBroken()
+		return nil, err
+	}
+	if !reply {
+		return nil, ErrNoReply
+	}
+	res, err := readResp(ctx, protocol, cmd)
+	// The connection stays usable after an error reply, e.g. to UNWATCH.
+	if err != nil && !inSync(err) {
+		c.con.SetBroken()
+	}
+	return res, err
+}
+
+func (c *Conn) Pipeline() *Pipeline {
+	return &Pipeline{exec: c.exec, dedicated: true}
+}
+
+func (c *Conn) TxPipeline() *Pipeline {
+	return &Pipeline{exec: c.exec, tx: true, dedicated: true}
+}
+
+func (c *Conn) TxPipelined(ctx context.Context, fn func(p *Pipeline) error) ([]interface{}, error) {
+	return txPipelined(ctx, c.TxPipeline(), fn)
+}
+
+// Select changes the database of the connection.
+func (c *Conn) Select(ctx context.Context, db int) error {
+	_, err := c.exec(ctx, &okCommand{args: []string{"SELECT", strconv.Itoa(db)}})
+	return err
+}
+
+// ClientReply sends CLIENT REPLY with mode ON, OFF or SKIP. While the replies
+// are off, and for the next command after SKIP, the commands are sent without
+// waiting for a reply and fail with ErrNoReply.
+func (c *Conn) ClientReply(ctx context.Context, mode string) error {
+	mode = strings.ToUpper(mode)
+	cmd := &okCommand{args: []string{"CLIENT", "REPLY", mode}}
+	switch mode {
+	case "ON":
+		if _, err := c.send(ctx, cmd, true); err != nil {
+			return err
+		}
+		c.replyMode = ""
+		return nil
+	case "OFF", "SKIP":
+		if _, err := c.send(ctx, cmd, false); !errors.Is(err, ErrNoReply) {
+			return err
+		}
+		c.replyMode = mode
+		return nil
+	default:
+		return errors.Wrap(ErrGodis, "invalid reply mode "+mode)
+	}
+}
+
+// Close resets the connection and gives it back to the pool. A broken
+// connection, or one that fails to reset, is closed instead.
+func (c *Conn) Close() error {
+	if c.closed {
+		return nil
+	}
+	if !c.con.IsBroken() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.client.config.DailTimeOut)
+		// RESET turns the replies on, but its own reply would be skipped.
+		if c.replyMode == "SKIP" {
+			c.replyMode = ""
+			_, _ = c.send(ctx, &doCommand{args: []string{"PING"}}, false)
+		}
+		if _, err := c.send(ctx, &resetCommand{}, true); err != nil {
+			log.Println("failed to reset connection: ", err)
+			c.con.SetBroken()
+		}
+		cancel()
+	}
+	c.closed = true
+	return c.client.conPool.Release(c.con)
+}
+
+type okCommand struct {
+	args []string
+}
+
+func (c *okCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, c.args, nil)
+}
+
+func (c *okCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readStatus(ctx, protocol, "OK")
+}
+
+type resetCommand struct{}
+
+func (c *resetCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, []string{"RESET"}, nil)
+}
+
+func (c *resetCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readStatus(ctx, protocol, "RESET")
+}
+
+func readStatus(ctx context.Context, protocol Protocol, status string) (interface{}, error) {
+	r, err := protocol.ReadSimpleString(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if string(r) != status {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	return nil, nil
+}
@@ -0,0 +1,153 @@
+package godis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	resetReply := "+RESET\r\n"
+	kv := kvHandler()
+	server := newFakeServer(t, func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, strings.Join(args, " "))
+		switch strings.ToUpper(args[0]) {
+		case "SELECT":
+			return "+OK\r\n"
+		case "RESET":
+			return resetReply
+		case "LRANGE":
+			return "*2\r\n$1\r\na\r\n:1\r\n"
+		default:
+			return kv(args)
+		}
+	})
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	conn, err := cli.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Select(ctx, 1))
+	_, err = conn.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	r, err := conn.Do(ctx, "LRANGE", "l", "0", "-1")
+	assert.Nil(t, err)
+	b := []byte("a")
+	assert.Equal(t, []interface{}{&b, int64(1)}, r)
+
+	// An error reply doesn't break the connection
+	_, err = conn.Do(ctx, "UNKNOWN")
+	var e Error
+	assert.ErrorAs(t, err, &e)
+	assert.Nil(t, conn.Close())
+	_, err = conn.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrClosedConn)
+
+	// The reset connection goes back to the pool
+	_, err = cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.ConNum())
+	mutex.Lock()
+	assert.Equal(t, []string{"SELECT 1", "SET k v", "LRANGE l 0 -1", "UNKNOWN", "RESET", "GET k"}, requests)
+	mutex.Unlock()
+
+	// A connection that can't be reset is discarded
+	mutex.Lock()
+	resetReply = "-ERR unknown command 'RESET'\r\n"
+	mutex.Unlock()
+	conn, err = cli.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Select(ctx, 1))
+	assert.Nil(t, conn.Close())
+	_, err = cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, server.ConNum())
+}
+
+func TestConnClientReply(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	mode := "ON"
+	kv := kvHandler()
+	server := newFakeServer(t, func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, strings.Join(args, " "))
+		res := kv(args)
+		switch strings.ToUpper(args[0]) {
+		case "CLIENT":
+			mode = strings.ToUpper(args[2])
+			if mode == "ON" {
+				return "+OK\r\n"
+			}
+			return ""
+		case "RESET":
+			mode = "ON"
+			return "+RESET\r\n"
+		}
+		switch mode {
+		case "OFF":
+			return ""
+		case "SKIP":
+			mode = "ON"
+			return ""
+		}
+		return res
+	})
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	conn, err := cli.Conn(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.ClientReply(ctx, "off"))
+	_, err = conn.Set(ctx, "k", "v")
+	assert.ErrorIs(t, err, ErrNoReply)
+	assert.Nil(t, conn.ClientReply(ctx, "ON"))
+	v, err := conn.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+
+	// SKIP only applies to the next command
+	assert.Nil(t, conn.ClientReply(ctx, "SKIP"))
+	_, err = conn.Set(ctx, "k", "v2")
+	assert.ErrorIs(t, err, ErrNoReply)
+	v, err = conn.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", *v)
+	assert.ErrorIs(t, conn.ClientReply(ctx, "MAYBE"), ErrGodis)
+
+	// The connection is reset with the replies off
+	assert.Nil(t, conn.ClientReply(ctx, "SKIP"))
+	assert.Nil(t, conn.Close())
+	_, err = cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.ConNum())
+	mutex.Lock()
+	assert.Equal(t, []string{
+		"CLIENT REPLY OFF", "SET k v", "CLIENT REPLY ON", "GET k",
+		"CLIENT REPLY SKIP", "SET k v2", "GET k",
+		"CLIENT REPLY SKIP", "PING", "RESET", "GET k",
+	}, requests)
+	mutex.Unlock()
+}
+
+func TestConnMultiplexed(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	cli, err := NewClient(&ClientConfig{Address: server.Addr(), MultiplexConns: 1})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	_, err = cli.Conn(context.Background())
+	assert.ErrorIs(t, err, ErrGodis)
+}
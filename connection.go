@@ -27,6 +27,37 @@ type ConnectionConfig struct {
 	Address     string
 	DialTimeOut time.Duration
 
+	// Addresses is an ordered list of addresses tried in turn until one accepts the connection.
+	// It takes precedence over Address.
+	Addresses []string
+	// How often the host names of Addresses are resolved again in the background. Default is 30
+	// seconds. A negative value resolves them before every dial instead.
+	ResolveInterval time.Duration
+	// Called when a connection is established to another address of Addresses than the previous one.
+	// It must not block.
+	OnAddressChange func(from, to string)
+	addrs           *addressList
+
+	// The URL of a proxy to connect through, either socks5://[user:password@]host:port or
+	// http://[user:password@]host:port for HTTP CONNECT. Host names are resolved by the proxy.
+	Proxy string
+
+	// Socket options
+	// The idle time before the first TCP keepalive probe. Zero uses Go's default (15 seconds),
+	// a negative value disables keepalive.
+	KeepAlive time.Duration
+	// The time between two keepalive probes. Only applied on Linux. Default is KeepAlive.
+	KeepAliveInterval time.Duration
+	// The number of unanswered probes after which the connection is dropped. Only applied on Linux.
+	// Default is the system setting.
+	KeepAliveCount int
+	// Disable TCP_NODELAY so that small writes are coalesced. Default is false.
+	DisableNoDelay bool
+	// The size of the socket receive buffer. Default is the system setting.
+	ReadBufferSize int
+	// The size of the socket send buffer. Default is the system setting.
+	WriteBufferSize int
+
 	Tls           bool
 	TlsCertPath   string
 	TlsCaCertPath string
@@ -35,9 +66,13 @@ type ConnectionConfig struct {
 
 type connection struct {
 	con        net.Conn
+	mutex      sync.Mutex
 	lastUsedAt time.Time
 	broken     bool
 	config     *ConnectionConfig
+	// Whether a read or write deadline is set on con.
+	readDeadline  bool
+	writeDeadline bool
 }
 
 func (c *connection) IsBroken() bool {
@@ -49,13 +84,23 @@ func (c *connection) SetBroken() {
 }
 
 func (c *connection) GetLastUsedAt() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.lastUsedAt
 }
 
+// touch records the use of the connection. Reads and writes may happen on
+// different goroutines when the connection is multiplexed.
+func (c *connection) touch() {
+	c.mutex.Lock()
+	c.lastUsedAt = time.Now()
+	c.mutex.Unlock()
+}
+
 func (c *connection) Close() error {
-	con := c.con
-	c.con = nil
-	return con.Close()
+	// The underlying connection is kept so that a pool shutting down can close
+	// a connection that is still being used by another goroutine.
+	return c.con.Close()
 }
 
 func (c *connection) Connect() error {
@@ -63,20 +108,89 @@ func (c *connection) Connect() error {
 		return nil
 	}
 
-	var err error
-	if c.config.Tls {
-		c.con, err = c.dialTls()
-	} else {
-		c.con, err = net.DialTimeout("tcp", c.config.Address, c.config.DialTimeOut)
-	}
+	con, err := c.dial()
 	if err != nil {
-		return errors.Wrap(err, "failed to connect to "+c.config.Address)
+		return errors.Wrap(err, "failed to connect to "+c.config.address())
 	}
+	c.con = con
 	c.lastUsedAt = time.Now()
 	return nil
 }
 
-func (c *connection) dialTls() (net.Conn, error) {
+func (c *connection) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.config.DialTimeOut, KeepAlive: c.config.KeepAlive}
+	address, con, err := c.dialAddress(dialer)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.setSocketOptions(con); err != nil {
+		con.Close()
+		return nil, err
+	}
+	if !c.config.Tls {
+		return con, nil
+	}
+
+	tlsCon, err := c.handshakeTls(con, address)
+	if err != nil {
+		con.Close()
+		return nil, err
+	}
+	return tlsCon, nil
+}
+
+// dialAddress connects to Address, or to the first reachable address of
+// Addresses, and returns the address used.
+func (c *connection) dialAddress(dialer *net.Dialer) (string, net.Conn, error) {
+	dial := dialer.Dial
+	if c.config.Proxy != "" {
+		pd, err := newProxyDialer(c.config.Proxy, dialer)
+		if err != nil {
+			return "", nil, err
+		}
+		dial = pd.Dial
+	}
+	if len(c.config.Addresses) == 0 {
+		con, err := dial("tcp", c.config.Address)
+		return c.config.Address, con, err
+	}
+	return c.config.addresses().dial(dial)
+}
+
+func (c *connection) setSocketOptions(con net.Conn) error {
+	// The reply of an HTTP CONNECT proxy may have been read together with
+	// the first bytes of the tunnel.
+	if b, ok := con.(*bufferedConn); ok {
+		con = b.Conn
+	}
+	tcpCon, ok := con.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if c.config.DisableNoDelay {
+		if err := tcpCon.SetNoDelay(false); err != nil {
+			return errors.Wrap(err, "failed to disable TCP_NODELAY")
+		}
+	}
+	if c.config.ReadBufferSize > 0 {
+		if err := tcpCon.SetReadBuffer(c.config.ReadBufferSize); err != nil {
+			return errors.Wrap(err, "failed to set read buffer size")
+		}
+	}
+	if c.config.WriteBufferSize > 0 {
+		if err := tcpCon.SetWriteBuffer(c.config.WriteBufferSize); err != nil {
+			return errors.Wrap(err, "failed to set write buffer size")
+		}
+	}
+	if c.config.KeepAlive >= 0 && (c.config.KeepAliveInterval > 0 || c.config.KeepAliveCount > 0) {
+		if err := setKeepAliveProbes(tcpCon, c.config.KeepAliveInterval, c.config.KeepAliveCount); err != nil {
+			return errors.Wrap(err, "failed to set keepalive probes")
+		}
+	}
+	return nil
+}
+
+func (c *connection) handshakeTls(con net.Conn, address string) (net.Conn, error) {
 	cert, err := tls.LoadX509KeyPair(c.config.TlsCertPath, c.config.TlsKeyPath)
 
 	if err != nil {
@@ -92,10 +206,27 @@ func (c *connection) dialTls() (net.Conn, error) {
 		return nil, errors.New("failed to load ca")
 	}
 
-	return tls.Dial("tcp", c.config.Address, &tls.Config{
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tlsCon := tls.Client(con, &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		RootCAs:      caPool,
+		ServerName:   host,
 	})
+	if c.config.DialTimeOut > 0 {
+		if err := con.SetDeadline(time.Now().Add(c.config.DialTimeOut)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := tlsCon.Handshake(); err != nil {
+		return nil, errors.Wrap(err, "tls handshake failed")
+	}
+	if err := con.SetDeadline(time.Time{}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return tlsCon, nil
 }
 
 func (c *connection) Read(ctx context.Context, p []byte) (n int, err error) {
@@ -103,16 +234,19 @@ func (c *connection) Read(ctx context.Context, p []byte) (n int, err error) {
 		return 0, err
 	}
 
-	if dl, ok := ctx.Deadline(); ok {
+	// The deadline of a previous caller is cleared, it would fail the
+	// callers without deadline.
+	if dl, ok := ctx.Deadline(); ok || c.readDeadline {
 		if err := c.con.SetReadDeadline(dl); err != nil {
 			return 0, errors.Wrap(err, "failed to set read deadline")
 		}
+		c.readDeadline = ok
 	}
 	n, err = c.con.Read(p)
 	if err != nil {
 		return n, errors.Wrap(err, "failed to read from connection")
 	}
-	c.lastUsedAt = time.Now()
+	c.touch()
 	return
 }
 
@@ -121,16 +255,19 @@ func (c *connection) Write(ctx context.Context, p []byte) (n int, err error) {
 		return 0, err
 	}
 
-	if dl, ok := ctx.Deadline(); ok {
+	// The deadline of a previous caller is cleared, it would fail the
+	// callers without deadline.
+	if dl, ok := ctx.Deadline(); ok || c.writeDeadline {
 		if err := c.con.SetWriteDeadline(dl); err != nil {
 			return 0, errors.Wrap(err, "failed to set write deadline")
 		}
+		c.writeDeadline = ok
 	}
 	n, err = c.con.Write(p)
 	if err != nil {
 		return n, errors.Wrap(err, "failed to write to connection")
 	}
-	c.lastUsedAt = time.Now()
+	c.touch()
 	return
 }
 
@@ -141,7 +278,12 @@ func NewConnection(config *ConnectionConfig) Connection {
 type ConnectionPool interface {
 	GetConnection() (Connection, error)
 	Release(Connection) error
+	// Close stops handing out connections and closes the idle ones.
+	// Connections in use are closed when they are released.
 	Close() error
+	// Shutdown closes the pool and waits for the connections in use to be
+	// released until ctx is done, then closes the remaining ones.
+	Shutdown(ctx context.Context) error
 }
 
 type ConnectionPoolConfig struct {
@@ -156,17 +298,20 @@ type connectionPool struct {
 	UsedConNum    uint
 	AllConNum     uint
 	pool          []Connection
+	conns         map[Connection]struct{}
 	newConnection func(*ConnectionConfig) Connection
 	mutex         *sync.Mutex
 	closed        bool
+	drained       chan struct{}
 	config        *ConnectionPoolConfig
 	conCloseChan  chan Connection
 }
 
 func NewConnectionPool(config *ConnectionPoolConfig) ConnectionPool {
+	config.initAddresses()
 	p := &connectionPool{mutex: &sync.Mutex{},
 		newConnection: NewConnection, conCloseChan: make(chan Connection),
-		config: config,
+		conns: make(map[Connection]struct{}), config: config,
 	}
 	p.startCloseConWorker()
 	return p
@@ -194,6 +339,7 @@ func (p *connectionPool) tryGetHealthConn() Connection {
 		con := p.popCon()
 		if time.Since(con.GetLastUsedAt()) > p.config.ConIdleTime {
 			p.AllConNum--
+			delete(p.conns, con)
 			p.conCloseChan <- con
 			continue
 		}
@@ -220,7 +366,7 @@ func (p *connectionPool) GetConnection() (Connection, error) {
 			return nil, err
 		}
 		p.AllConNum++
-
+		p.conns[con] = struct{}{}
 	}
 	p.clearIdleCon()
 	p.UsedConNum++
@@ -231,6 +377,7 @@ func (p *connectionPool) clearIdleCon() {
 	if p.config.MaxIdleConNum != 0 && len(p.pool) > int(p.config.MaxIdleConNum) {
 		con := p.popCon()
 		p.AllConNum--
+		delete(p.conns, con)
 		p.conCloseChan <- con
 	}
 }
@@ -240,12 +387,13 @@ func (p *connectionPool) Release(conn Connection) error {
 	defer p.mutex.Unlock()
 
 	if p.closed {
-		return ErrClosedPool
+		return p.releaseToClosedPool(conn)
 	}
 
 	p.UsedConNum--
 	if conn.IsBroken() {
 		p.AllConNum--
+		delete(p.conns, conn)
 		p.conCloseChan <- conn
 		return nil
 	}
@@ -253,6 +401,24 @@ func (p *connectionPool) Release(conn Connection) error {
 	return nil
 }
 
+// releaseToClosedPool closes a connection that was borrowed before the pool
+// was closed. The caller must hold the mutex.
+func (p *connectionPool) releaseToClosedPool(conn Connection) error {
+	if _, ok := p.conns[conn]; !ok {
+		return ErrClosedPool
+	}
+	delete(p.conns, conn)
+	p.AllConNum--
+	p.UsedConNum--
+	if p.UsedConNum == 0 {
+		close(p.drained)
+	}
+	if err := conn.Close(); err != nil {
+		log.Println("failed to close connection: ", err)
+	}
+	return nil
+}
+
 func (p *connectionPool) Close() error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -260,14 +426,50 @@ func (p *connectionPool) Close() error {
 	if p.closed {
 		return nil
 	}
+	p.config.closeAddresses()
 
 	for _, conn := range p.pool {
+		delete(p.conns, conn)
 		p.conCloseChan <- conn
 	}
 	close(p.conCloseChan)
 	p.pool = nil
 	p.closed = true
+	p.AllConNum = p.UsedConNum
+	p.drained = make(chan struct{})
+	if p.UsedConNum == 0 {
+		close(p.drained)
+	}
+	return nil
+}
+
+func (p *connectionPool) Shutdown(ctx context.Context) error {
+	if err := p.Close(); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	drained := p.drained
+	p.mutex.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.UsedConNum == 0 {
+		return nil
+	}
+	for conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			log.Println("failed to close connection: ", err)
+		}
+	}
+	p.conns = make(map[Connection]struct{})
 	p.AllConNum = 0
 	p.UsedConNum = 0
-	return nil
+	close(p.drained)
+	return ctx.Err()
 }
@@ -2,7 +2,9 @@ package godis
 
 import (
 	"context"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -58,6 +60,54 @@ func TestConnectionReadWithDeadline(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestConnectionReadClearsDeadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	dl, _ := ctx.Deadline()
+	defer cancel()
+
+	con := connection{con: NewMockConn(ctrl)}
+	gomock.InOrder(
+		con.con.(*MockConn).EXPECT().SetReadDeadline(dl).Return(nil),
+		con.con.(*MockConn).EXPECT().Read(gomock.Any()).Return(0, nil),
+		con.con.(*MockConn).EXPECT().SetReadDeadline(time.Time{}).Return(nil),
+		con.con.(*MockConn).EXPECT().Read(gomock.Any()).Return(0, nil).Times(2),
+	)
+
+	_, err := con.Read(ctx, []byte{})
+	assert.Nil(t, err)
+	_, err = con.Read(context.Background(), []byte{})
+	assert.Nil(t, err)
+	_, err = con.Read(context.Background(), []byte{})
+	assert.Nil(t, err)
+}
+
+func TestConnectionWriteClearsDeadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	dl, _ := ctx.Deadline()
+	defer cancel()
+
+	con := connection{con: NewMockConn(ctrl)}
+	gomock.InOrder(
+		con.con.(*MockConn).EXPECT().SetWriteDeadline(dl).Return(nil),
+		con.con.(*MockConn).EXPECT().Write(gomock.Any()).Return(0, nil),
+		con.con.(*MockConn).EXPECT().SetWriteDeadline(time.Time{}).Return(nil),
+		con.con.(*MockConn).EXPECT().Write(gomock.Any()).Return(0, nil).Times(2),
+	)
+
+	_, err := con.Write(ctx, []byte{})
+	assert.Nil(t, err)
+	_, err = con.Write(context.Background(), []byte{})
+	assert.Nil(t, err)
+	_, err = con.Write(context.Background(), []byte{})
+	assert.Nil(t, err)
+}
+
 func TestConnectionWriteWithCanceled(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -87,24 +137,19 @@ func TestConnectionWriteWithDeadline(t *testing.T) {
 }
 
 func getMockConnectionPool(ctrl *gomock.Controller) *connectionPool {
-	var cp *connectionPool = &connectionPool{
-		config: &ConnectionPoolConfig{
-			ConnectionConfig: ConnectionConfig{Address: "1.0.0.1"},
-			MaxConNum:        10,
-			ConIdleTime:      defaultConIdleTime,
-		},
-		newConnection: func(cfg *ConnectionConfig) Connection {
-			c := NewMockConnection(ctrl)
-			c.EXPECT().Connect().Return(nil).Times(1)
-			c.EXPECT().Close().Return(nil).Times(1)
-			c.EXPECT().GetLastUsedAt().Return(time.Now()).AnyTimes()
-			c.EXPECT().IsBroken().Return(false).AnyTimes()
-			return c
-		},
-		mutex:        &sync.Mutex{},
-		conCloseChan: make(chan Connection),
+	cp := NewConnectionPool(&ConnectionPoolConfig{
+		ConnectionConfig: ConnectionConfig{Address: "1.0.0.1"},
+		MaxConNum:        10,
+		ConIdleTime:      defaultConIdleTime,
+	}).(*connectionPool)
+	cp.newConnection = func(cfg *ConnectionConfig) Connection {
+		c := NewMockConnection(ctrl)
+		c.EXPECT().Connect().Return(nil).Times(1)
+		c.EXPECT().Close().Return(nil).Times(1)
+		c.EXPECT().GetLastUsedAt().Return(time.Now()).AnyTimes()
+		c.EXPECT().IsBroken().Return(false).AnyTimes()
+		return c
 	}
-	cp.startCloseConWorker()
 	return cp
 }
 
@@ -119,7 +164,7 @@ func TestConnection(t *testing.T) {
 	assert.IsType(t, &MockConnection{}, conn)
 	assert.EqualValues(t, 1, cp.AllConNum)
 	assert.EqualValues(t, 1, cp.UsedConNum)
-	assert.EqualValues(t, 0, len(cp.pool))
+	assert.Equal(t, 0, len(cp.pool))
 
 	// Release connection
 	err = cp.Release(conn)
@@ -226,3 +271,192 @@ func TestReleaseBrokenConnectin(t *testing.T) {
 	// Wait for closeConWorker
 	time.Sleep(time.Millisecond)
 }
+
+func TestReleaseToClosedPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cp := getMockConnectionPool(ctrl)
+	conn, err := cp.GetConnection()
+	assert.Nil(t, err)
+
+	err = cp.Close()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, cp.AllConNum)
+	assert.EqualValues(t, 1, cp.UsedConNum)
+
+	// The borrowed connection is closed instead of leaking
+	err = cp.Release(conn)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, cp.AllConNum)
+	assert.EqualValues(t, 0, cp.UsedConNum)
+	assert.Equal(t, 0, len(cp.conns))
+}
+
+func TestShutdownWaitsForInFlight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cp := getMockConnectionPool(ctrl)
+	conn, err := cp.GetConnection()
+	assert.Nil(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, cp.Release(conn))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = cp.Shutdown(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, cp.UsedConNum)
+
+	_, err = cp.GetConnection()
+	assert.ErrorIs(t, err, ErrClosedPool)
+}
+
+func TestShutdownClosesBorrowedAfterDeadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cp := getMockConnectionPool(ctrl)
+	conn, err := cp.GetConnection()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = cp.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualValues(t, 0, cp.AllConNum)
+	assert.EqualValues(t, 0, cp.UsedConNum)
+
+	// Already closed by Shutdown
+	err = cp.Release(conn)
+	assert.ErrorIs(t, err, ErrClosedPool)
+}
+
+// benchConnection is a Connection that does nothing, so that the benchmarks
+// only measure the pool.
+type benchConnection struct {
+	lastUsedAt time.Time
+}
+
+func (c *benchConnection) Read(ctx context.Context, p []byte) (int, error)  { return len(p), nil }
+func (c *benchConnection) Write(ctx context.Context, p []byte) (int, error) { return len(p), nil }
+func (c *benchConnection) GetLastUsedAt() time.Time                         { return c.lastUsedAt }
+func (c *benchConnection) IsBroken() bool                                   { return false }
+func (c *benchConnection) SetBroken()                                       {}
+func (c *benchConnection) Connect() error                                   { c.lastUsedAt = time.Now(); return nil }
+func (c *benchConnection) Close() error                                     { return nil }
+
+func BenchmarkConnectionPool(b *testing.B) {
+	cp := NewConnectionPool(&ConnectionPoolConfig{
+		ConIdleTime: time.Hour,
+		MaxConNum:   1024,
+	}).(*connectionPool)
+	cp.newConnection = func(*ConnectionConfig) Connection {
+		return &benchConnection{}
+	}
+	defer cp.Close()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			con, err := cp.GetConnection()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := cp.Release(con); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// trackedConnection counts the connections that are not closed yet.
+type trackedConnection struct {
+	benchConnection
+	open   *int64
+	broken int32
+}
+
+func (c *trackedConnection) Connect() error {
+	atomic.AddInt64(c.open, 1)
+	return c.benchConnection.Connect()
+}
+
+func (c *trackedConnection) Close() error {
+	atomic.AddInt64(c.open, -1)
+	return nil
+}
+
+func (c *trackedConnection) IsBroken() bool {
+	return atomic.LoadInt32(&c.broken) == 1
+}
+
+func (c *trackedConnection) SetBroken() {
+	atomic.StoreInt32(&c.broken, 1)
+}
+
+func TestConnectionPoolConcurrentLimit(t *testing.T) {
+	var open, used, maxUsed, maxAll int64
+	cp := NewConnectionPool(&ConnectionPoolConfig{
+		ConIdleTime:   time.Hour,
+		MaxConNum:     4,
+		MaxIdleConNum: 2,
+	}).(*connectionPool)
+	cp.newConnection = func(*ConnectionConfig) Connection {
+		return &trackedConnection{open: &open}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				con, err := cp.GetConnection()
+				if err != nil {
+					assert.ErrorIs(t, err, ErrConnectionPoolFull)
+					runtime.Gosched()
+					continue
+				}
+				storeMax(&maxUsed, atomic.AddInt64(&used, 1))
+				storeMax(&maxAll, allConNum(cp))
+				// Destroyed connections make room for new ones
+				if (i+j)%7 == 0 {
+					con.SetBroken()
+				}
+				runtime.Gosched()
+				atomic.AddInt64(&used, -1)
+				assert.Nil(t, cp.Release(con))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, atomic.LoadInt64(&maxUsed), int64(4))
+	assert.LessOrEqual(t, atomic.LoadInt64(&maxAll), int64(4))
+
+	// The destroyed connections are closed in the background
+	assert.Nil(t, cp.Close())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&open) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func storeMax(max *int64, n int64) {
+	for {
+		m := atomic.LoadInt64(max)
+		if n <= m || atomic.CompareAndSwapInt64(max, m, n) {
+			return
+		}
+	}
+}
+
+// allConNum returns the number of connections counted by the pool.
+func allConNum(cp *connectionPool) int64 {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return int64(cp.AllConNum)
+}
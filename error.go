@@ -8,5 +8,11 @@ import (
 var ErrGodis = errors.New("godis error")
 var ErrClosedPool = fmt.Errorf("connection pool is closed: %w", ErrGodis)
 var ErrConnectionPoolFull = fmt.Errorf("connection pool is full: %w", ErrGodis)
+var ErrClosedConn = fmt.Errorf("connection is closed: %w", ErrGodis)
+var ErrCrossSlot = fmt.Errorf("keys don't hash to the same cluster slot: %w", ErrGodis)
+var ErrCrossShard = fmt.Errorf("keys don't hash to the same ring shard: %w", ErrGodis)
+var ErrTxFailed = fmt.Errorf("transaction failed, a watched key was modified: %w", ErrGodis)
+var ErrCircuitOpen = fmt.Errorf("circuit breaker is open: %w", ErrGodis)
+var ErrNoReply = fmt.Errorf("command sent without reply, see CLIENT REPLY: %w", ErrGodis)
 
 var errUnexpectedRes = errors.New("unexpected response")
@@ -0,0 +1,205 @@
+package godis
+
+// pipelineCmd is the typed result of a command queued in a pipeline, filled
+// in by Exec.
+type pipelineCmd interface {
+	set(res interface{}, err error)
+}
+
+// baseCmd holds the error of a command, nil until Exec runs.
+type baseCmd struct {
+	err error
+}
+
+func (c *baseCmd) Err() error {
+	return c.err
+}
+
+// StatusCmd is the result of a command replying OK.
+type StatusCmd struct {
+	baseCmd
+}
+
+func (c *StatusCmd) set(res interface{}, err error) {
+	c.err = err
+}
+
+type BoolCmd struct {
+	baseCmd
+	val bool
+}
+
+func (c *BoolCmd) Val() bool {
+	return c.val
+}
+
+func (c *BoolCmd) Result() (bool, error) {
+	return c.val, c.err
+}
+
+func (c *BoolCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(bool)
+	}
+}
+
+type IntCmd struct {
+	baseCmd
+	val int64
+}
+
+func (c *IntCmd) Val() int64 {
+	return c.val
+}
+
+func (c *IntCmd) Result() (int64, error) {
+	return c.val, c.err
+}
+
+func (c *IntCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(int64)
+	}
+}
+
+type UintCmd struct {
+	baseCmd
+	val uint
+}
+
+func (c *UintCmd) Val() uint {
+	return c.val
+}
+
+func (c *UintCmd) Result() (uint, error) {
+	return c.val, c.err
+}
+
+func (c *UintCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(uint)
+	}
+}
+
+type FloatCmd struct {
+	baseCmd
+	val float64
+}
+
+func (c *FloatCmd) Val() float64 {
+	return c.val
+}
+
+func (c *FloatCmd) Result() (float64, error) {
+	return c.val, c.err
+}
+
+func (c *FloatCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(float64)
+	}
+}
+
+type StringCmd struct {
+	baseCmd
+	val string
+}
+
+func (c *StringCmd) Val() string {
+	return c.val
+}
+
+func (c *StringCmd) Result() (string, error) {
+	return c.val, c.err
+}
+
+func (c *StringCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(string)
+	}
+}
+
+type NullStringCmd struct {
+	baseCmd
+	val *string
+}
+
+func (c *NullStringCmd) Val() *string {
+	return c.val
+}
+
+func (c *NullStringCmd) Result() (*string, error) {
+	return c.val, c.err
+}
+
+func (c *NullStringCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(*string)
+	}
+}
+
+type NullStringSliceCmd struct {
+	baseCmd
+	val []*string
+}
+
+func (c *NullStringSliceCmd) Val() []*string {
+	return c.val
+}
+
+func (c *NullStringSliceCmd) Result() ([]*string, error) {
+	return c.val, c.err
+}
+
+func (c *NullStringSliceCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.([]*string)
+	}
+}
+
+type LcsIdxCmd struct {
+	baseCmd
+	val LcsIdxRes
+}
+
+func (c *LcsIdxCmd) Val() LcsIdxRes {
+	return c.val
+}
+
+func (c *LcsIdxCmd) Result() (LcsIdxRes, error) {
+	return c.val, c.err
+}
+
+func (c *LcsIdxCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(LcsIdxRes)
+	}
+}
+
+type ScanCmd struct {
+	baseCmd
+	val ScanRes
+}
+
+func (c *ScanCmd) Val() ScanRes {
+	return c.val
+}
+
+func (c *ScanCmd) Result() (ScanRes, error) {
+	return c.val, c.err
+}
+
+func (c *ScanCmd) set(res interface{}, err error) {
+	c.err = err
+	if err == nil {
+		c.val = res.(ScanRes)
+	}
+}
@@ -0,0 +1,138 @@
+package godis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type ScanRes struct {
+	Keys []string
+	// The cursor of the next call, 0 when the iteration is complete.
+	Cursor uint64
+}
+
+// ScanIterator returns an iterator over the keys matching args, see Scan.
+func (c cmdable) ScanIterator(args ...arg) *ScanIterator {
+	return &ScanIterator{sources: []scanSource{{scan: c.Scan}}, args: args}
+}
+
+type scanSource struct {
+	addr string
+	scan func(ctx context.Context, cursor uint64, args ...arg) (ScanRes, error)
+}
+
+// ScanIterator iterates over the keys returned by successive SCAN calls. In
+// cluster mode it walks every primary in turn.
+type ScanIterator struct {
+	// Sets sources up on the first call to Next.
+	init    func(ctx context.Context) error
+	err     error
+	sources []scanSource
+	args    []arg
+	source  int
+	cursor  uint64
+	started bool
+	keys    []string
+	key     string
+	errs    map[string]error
+}
+
+// Next advances to the next key and reports whether there is one. A failed
+// node is skipped, the error is reported by Err.
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	if it.init != nil {
+		it.err = it.init(ctx)
+		it.init = nil
+	}
+	if it.err != nil {
+		return false
+	}
+	for len(it.keys) == 0 {
+		if it.source >= len(it.sources) {
+			return false
+		}
+		if it.started && it.cursor == 0 {
+			it.nextSource()
+			continue
+		}
+		src := it.sources[it.source]
+		res, err := src.scan(ctx, it.cursor, it.args...)
+		if err != nil {
+			if it.errs == nil {
+				it.errs = make(map[string]error)
+			}
+			it.errs[src.addr] = err
+			if ctx.Err() != nil {
+				it.source = len(it.sources)
+				return false
+			}
+			it.nextSource()
+			continue
+		}
+		it.started = true
+		it.cursor = res.Cursor
+		it.keys = res.Keys
+	}
+	it.key = it.keys[0]
+	it.keys = it.keys[1:]
+	return true
+}
+
+func (it *ScanIterator) nextSource() {
+	it.source++
+	it.cursor = 0
+	it.started = false
+}
+
+// Key returns the current key.
+func (it *ScanIterator) Key() string {
+	return it.key
+}
+
+// Err returns the error of the iteration. In cluster mode it is a
+// *ClusterError holding the error of each failed primary.
+func (it *ScanIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if len(it.errs) == 0 {
+		return nil
+	}
+	if len(it.sources) == 1 && it.sources[0].addr == "" {
+		return it.errs[""]
+	}
+	return &ClusterError{Errors: it.errs}
+}
+
+func readScanRes(ctx context.Context, protocol Protocol) (interface{}, error) {
+	arr, err := protocol.ReadArray(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) != 2 {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	cursor, err := strconv.ParseUint(replyString(arr[0]), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(errUnexpectedRes, "invalid cursor")
+	}
+	items, ok := arr[1].([]interface{})
+	if !ok {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	res := ScanRes{Cursor: cursor, Keys: make([]string, 0, len(items))}
+	for _, item := range items {
+		res.Keys = append(res.Keys, replyString(item))
+	}
+	return res, nil
+}
+
+func sumIntegers(indexes [][]int, results []interface{}) interface{} {
+	var sum int64
+	for _, r := range results {
+		sum += r.(int64)
+	}
+	return sum
+}
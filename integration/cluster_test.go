@@ -0,0 +1,77 @@
+package e2e
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Haylen-Z/godis"
+	"github.com/stretchr/testify/assert"
+)
+
+// The cluster tests run against the nodes listed in GODIS_CLUSTER_ADDRS, e.g.
+// 127.0.0.1:30001,127.0.0.1:30002 for the cluster started by
+// utils/create-cluster in the Redis sources.
+func setupClusterClient(t *testing.T) *godis.ClusterClient {
+	addrs := os.Getenv("GODIS_CLUSTER_ADDRS")
+	if addrs == "" {
+		t.Skip("GODIS_CLUSTER_ADDRS is not set")
+	}
+	cli, err := godis.NewClusterClient(&godis.ClusterConfig{
+		ClientConfig: godis.ClientConfig{Addresses: strings.Split(addrs, ",")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		assert.Nil(t, cli.Close())
+	})
+	return cli
+}
+
+func TestClusterGetAndSet(t *testing.T) {
+	cli := setupClusterClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		key := "kcluster" + strconv.Itoa(i)
+		_, err := cli.Set(ctx, key, strconv.Itoa(i))
+		assert.Nil(t, err)
+		val, err := cli.Get(ctx, key)
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), *val)
+	}
+
+	r, err := cli.MGet(ctx, "{kcluster}1", "{kcluster}2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(r))
+}
+
+func TestClusterCrossSlot(t *testing.T) {
+	cli := setupClusterClient(t)
+	ctx := context.Background()
+
+	kvs := map[string]string{}
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := "kcrossslot" + strconv.Itoa(i)
+		kvs[key] = strconv.Itoa(i)
+		keys = append(keys, key)
+	}
+	assert.Nil(t, cli.MSet(ctx, kvs))
+
+	vals, err := cli.MGet(ctx, keys...)
+	assert.Nil(t, err)
+	for i, v := range vals {
+		assert.Equal(t, strconv.Itoa(i), *v)
+	}
+
+	n, err := cli.Del(ctx, keys...)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), n)
+
+	_, err = cli.MSetNX(ctx, kvs)
+	assert.ErrorIs(t, err, godis.ErrCrossSlot)
+}
@@ -0,0 +1,61 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Haylen-Z/godis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericDelAndExists(t *testing.T) {
+	setupClient()
+	defer teardownClient()
+	ctx := context.Background()
+
+	assert.Nil(t, client.MSet(ctx, map[string]string{"kgeneric1": "1", "kgeneric2": "2", "kgeneric3": "3"}))
+
+	n, err := client.Exists(ctx, "kgeneric1", "kgeneric2", "kgenericmissing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = client.Touch(ctx, "kgeneric1", "kgenericmissing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = client.Del(ctx, "kgeneric1", "kgenericmissing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = client.Unlink(ctx, "kgeneric2", "kgeneric3")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = client.Exists(ctx, "kgeneric1", "kgeneric2", "kgeneric3")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestGenericScan(t *testing.T) {
+	setupClient()
+	defer teardownClient()
+	ctx := context.Background()
+
+	kvs := map[string]string{}
+	for _, k := range []string{"kscan:1", "kscan:2", "kscan:3"} {
+		kvs[k] = "v"
+	}
+	assert.Nil(t, client.MSet(ctx, kvs))
+
+	scanned := map[string]bool{}
+	it := client.ScanIterator(godis.MATCHArg("kscan:*"), godis.COUNTArg(1))
+	for it.Next(ctx) {
+		scanned[it.Key()] = true
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 3, len(scanned))
+
+	res, err := client.Scan(ctx, 0, godis.MATCHArg("kscan:*"), godis.TYPEArg("string"))
+	assert.Nil(t, err)
+	assert.True(t, len(res.Keys) <= 3)
+}
@@ -120,3 +120,59 @@ func TestStringPipeline(t *testing.T) {
 	// SubStr
 	assert.Equal(t, "sv", popRes().(string))
 }
+
+func TestTxPipeline(t *testing.T) {
+	setupClient()
+	defer teardownClient()
+	ctx := context.Background()
+
+	key := "ktxpipeline"
+	p := client.TxPipeline()
+	set := p.Set(key, "1")
+	incr := p.Incr(key)
+	res, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.True(t, set.Val())
+	assert.Equal(t, int64(2), incr.Val())
+
+	// A queued command with a wrong number of arguments aborts the transaction
+	_, err = client.TxPipelined(ctx, func(p *godis.Pipeline) error {
+		p.Incr(key)
+		p.MSet(map[string]string{})
+		return nil
+	})
+	var pe *godis.PipelineError
+	assert.ErrorAs(t, err, &pe)
+	var e godis.Error
+	assert.ErrorAs(t, pe.Errors[0], &e)
+	assert.Equal(t, "EXECABORT", e.Type)
+	v, err := client.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", *v)
+}
+
+func TestWatch(t *testing.T) {
+	setupClient()
+	defer teardownClient()
+	ctx := context.Background()
+
+	key := "kwatch"
+	_, err := client.Set(ctx, key, "1")
+	assert.Nil(t, err)
+	err = client.Watch(ctx, func(tx *godis.Conn) error {
+		// Modified by another connection after WATCH
+		if _, err := client.Set(ctx, key, "2"); err != nil {
+			return err
+		}
+		_, err := tx.TxPipelined(ctx, func(p *godis.Pipeline) error {
+			p.Set(key, "3")
+			return nil
+		})
+		return err
+	}, key)
+	assert.ErrorIs(t, err, godis.ErrTxFailed)
+	v, err := client.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", *v)
+}
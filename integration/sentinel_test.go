@@ -0,0 +1,33 @@
+package e2e
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Haylen-Z/godis"
+	"github.com/stretchr/testify/assert"
+)
+
+// The sentinel tests run against the sentinels listed in GODIS_SENTINEL_ADDRS
+// monitoring the master named mymaster.
+func TestFailoverGetAndSet(t *testing.T) {
+	addrs := os.Getenv("GODIS_SENTINEL_ADDRS")
+	if addrs == "" {
+		t.Skip("GODIS_SENTINEL_ADDRS is not set")
+	}
+	cli, err := godis.NewFailoverClient(&godis.FailoverConfig{
+		MasterName:    "mymaster",
+		SentinelAddrs: strings.Split(addrs, ","),
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	_, err = cli.Set(ctx, "kfailover", "v")
+	assert.Nil(t, err)
+	val, err := cli.Get(ctx, "kfailover")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *val)
+}
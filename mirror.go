@@ -0,0 +1,315 @@
+package godis
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMirrorWorkers       = 16
+	defaultMirrorQueueSize     = 1000
+	defaultMirrorShadowTimeout = 5 * time.Second
+)
+
+type MirrorConfig struct {
+	// The client whose results are returned.
+	Primary Client
+	// The client receiving a copy of the commands. Its results are only
+	// compared with the ones of Primary.
+	Shadow Client
+	// Send the read-only commands to Shadow too. Default is false, only the
+	// writes are sent to it.
+	MirrorReads bool
+	// Called from a background goroutine when Shadow returned another result
+	// than Primary.
+	OnMismatch func(m *MirrorMismatch)
+	// The number of goroutines sending the commands to Shadow. The commands
+	// on the same key are sent by the same goroutine, in order. Default is 16.
+	Workers int
+	// The number of commands waiting for each goroutine, beyond which the
+	// commands are not sent to Shadow, see Dropped. Default is 1000.
+	QueueSize int
+	// The timeout of a command sent to Shadow. Default is 5 seconds.
+	ShadowTimeout time.Duration
+}
+
+func (c *MirrorConfig) check() error {
+	if c.Primary == nil || c.Shadow == nil {
+		return errors.Wrap(ErrGodis, "primary and shadow clients are required")
+	}
+	if _, ok := c.Primary.(commandExecutor); !ok {
+		return errors.Wrap(ErrGodis, "the primary client is not a client of this package")
+	}
+	if _, ok := c.Shadow.(commandExecutor); !ok {
+		return errors.Wrap(ErrGodis, "the shadow client is not a client of this package")
+	}
+	if c.Workers == 0 {
+		c.Workers = defaultMirrorWorkers
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultMirrorQueueSize
+	}
+	if c.ShadowTimeout == 0 {
+		c.ShadowTimeout = defaultMirrorShadowTimeout
+	}
+	return nil
+}
+
+// MirrorMismatch describes a command whose result differs between the
+// primary and the shadow.
+type MirrorMismatch struct {
+	// The requests sent, several for a pipeline, e.g. [[SET k v]].
+	Requests   [][]string
+	Primary    interface{}
+	PrimaryErr error
+	Shadow     interface{}
+	ShadowErr  error
+}
+
+// commandExecutor is implemented by the clients of this package.
+type commandExecutor interface {
+	exec(ctx context.Context, cmd Command) (interface{}, error)
+}
+
+// MirrorClient sends the commands to a primary client, and a copy of them to
+// a shadow client in the background, e.g. to fill a new deployment and check
+// it before switching to it. Callers only see the result and the latency of
+// the primary. The commands not known to be read-only, including the ones
+// sent with Do, are considered writes. Only the commands executed by the
+// primary are mirrored, and the transactions run with Watch are not.
+type MirrorClient struct {
+	// The number of commands not sent to the shadow because their queue was
+	// full. First for its 64-bit alignment.
+	dropped uint64
+
+	cmdable
+	config  *MirrorConfig
+	primary commandExecutor
+	shadow  commandExecutor
+
+	mutex  sync.RWMutex
+	closed bool
+	queues []chan *mirrorTask
+	// Closed by Close to drop the queued commands.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type mirrorTask struct {
+	cmd        Command
+	primary    interface{}
+	primaryErr error
+}
+
+var _ Client = (*MirrorClient)(nil)
+
+func NewMirrorClient(config *MirrorConfig) (*MirrorClient, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	c := &MirrorClient{
+		config:  config,
+		primary: config.Primary.(commandExecutor),
+		shadow:  config.Shadow.(commandExecutor),
+		done:    make(chan struct{}),
+	}
+	c.cmdable = c.exec
+	for i := 0; i < config.Workers; i++ {
+		queue := make(chan *mirrorTask, config.QueueSize)
+		c.queues = append(c.queues, queue)
+		c.wg.Add(1)
+		go c.work(queue)
+	}
+	return c, nil
+}
+
+func (c *MirrorClient) Pipeline() *Pipeline {
+	return &Pipeline{exec: c.exec}
+}
+
+// Conn checks a connection out of the primary. Its commands are not sent to
+// the shadow.
+func (c *MirrorClient) Conn(ctx context.Context) (*Conn, error) {
+	return c.config.Primary.Conn(ctx)
+}
+
+// Watch runs the transaction on the primary only, it is not mirrored.
+func (c *MirrorClient) Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error {
+	return c.config.Primary.Watch(ctx, fn, keys...)
+}
+
+// Close drops the commands waiting to be sent to the shadow and closes both
+// clients.
+func (c *MirrorClient) Close() error {
+	if !c.stop() {
+		return nil
+	}
+	close(c.done)
+	c.wg.Wait()
+	return c.closeClients(func(cli Client) error {
+		return cli.Close()
+	})
+}
+
+// Shutdown waits for the commands queued for the shadow to be sent until ctx
+// is done, then shuts both clients down.
+func (c *MirrorClient) Shutdown(ctx context.Context) error {
+	if !c.stop() {
+		return nil
+	}
+	drained := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		close(c.done)
+		<-drained
+	}
+	return c.closeClients(func(cli Client) error {
+		return cli.Shutdown(ctx)
+	})
+}
+
+// stop stops queuing commands, it returns false if it was already stopped.
+func (c *MirrorClient) stop() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	for _, queue := range c.queues {
+		close(queue)
+	}
+	return true
+}
+
+func (c *MirrorClient) closeClients(closeClient func(Client) error) error {
+	err := closeClient(c.config.Primary)
+	if err1 := closeClient(c.config.Shadow); err1 != nil && err == nil {
+		err = errors.Wrap(err1, "failed to close shadow")
+	}
+	return err
+}
+
+func (c *MirrorClient) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if p, ok := cmd.(*Pipeline); ok {
+		// The caller may add commands to the pipeline once it returns.
+		cmd = &Pipeline{commands: append([]Command(nil), p.commands...)}
+	}
+	res, err := c.primary.exec(ctx, cmd)
+	if executed(err) && c.mirrored(cmd) {
+		c.enqueue(&mirrorTask{cmd: cmd, primary: res, primaryErr: err})
+	}
+	return res, err
+}
+
+// Dropped returns the number of commands not sent to the shadow because the
+// queue of their goroutine was full.
+func (c *MirrorClient) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// executed reports whether the primary executed the command that returned
+// err, e.g. not when its pool was closed or its circuit breaker open.
+func executed(err error) bool {
+	var e Error
+	var pe *PipelineError
+	return err == nil || errors.As(err, &e) || errors.As(err, &pe)
+}
+
+// mirrored reports whether cmd is sent to the shadow. SCAN isn't, since
+// cursors differ between servers.
+func (c *MirrorClient) mirrored(cmd Command) bool {
+	if _, ok := cmd.(*genericScanCommand); ok {
+		return false
+	}
+	return c.config.MirrorReads || !isReadOnly(cmd)
+}
+
+func (c *MirrorClient) enqueue(task *mirrorTask) {
+	i := 0
+	if keys := commandKeys(task.cmd); len(keys) > 0 {
+		i = hashSlot(keys[0]) % len(c.queues)
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queues[i] <- task:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+	}
+}
+
+func (c *MirrorClient) work(queue chan *mirrorTask) {
+	defer c.wg.Done()
+	for task := range queue {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		c.mirror(task)
+	}
+}
+
+// mirror sends the command of task to the shadow and reports a mismatch.
+func (c *MirrorClient) mirror(task *mirrorTask) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.ShadowTimeout)
+	defer cancel()
+	res, err := c.shadow.exec(ctx, task.cmd)
+	if c.config.OnMismatch == nil {
+		return
+	}
+	if reflect.DeepEqual(res, task.primary) && errorString(err) == errorString(task.primaryErr) {
+		return
+	}
+	c.config.OnMismatch(&MirrorMismatch{
+		Requests:   commandRequests(task.cmd),
+		Primary:    task.primary,
+		PrimaryErr: task.primaryErr,
+		Shadow:     res,
+		ShadowErr:  err,
+	})
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// requestRecorder is a Protocol recording the requests of a command instead
+// of sending them.
+type requestRecorder struct {
+	Protocol
+	requests [][]string
+}
+
+func (r *requestRecorder) WriteBulkStringArray(ctx context.Context, bss [][]byte) error {
+	req := make([]string, 0, len(bss))
+	for _, bs := range bss {
+		req = append(req, string(bs))
+	}
+	r.requests = append(r.requests, req)
+	return nil
+}
+
+// commandRequests returns the requests sent by cmd.
+func commandRequests(cmd Command) [][]string {
+	r := &requestRecorder{}
+	_ = cmd.SendReq(context.Background(), r)
+	return r.requests
+}
@@ -0,0 +1,122 @@
+package godis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorClient(t *testing.T) {
+	primaryServer := newFakeServer(t, kvHandler())
+	var mutex sync.Mutex
+	var shadowRequests []string
+	shadowKv := kvHandler()
+	shadowServer := newFakeServer(t, func(args []string) string {
+		time.Sleep(50 * time.Millisecond)
+		mutex.Lock()
+		shadowRequests = append(shadowRequests, strings.Join(args, " "))
+		mutex.Unlock()
+		return shadowKv(args)
+	})
+	primary, err := NewClient(&ClientConfig{Address: primaryServer.Addr()})
+	assert.Nil(t, err)
+	shadow, err := NewClient(&ClientConfig{Address: shadowServer.Addr()})
+	assert.Nil(t, err)
+	mismatches := make(chan *MirrorMismatch, 10)
+	cli, err := NewMirrorClient(&MirrorConfig{
+		Primary:     primary,
+		Shadow:      shadow,
+		MirrorReads: true,
+		OnMismatch: func(m *MirrorMismatch) {
+			mismatches <- m
+		},
+	})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = cli.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	v, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+
+	// A key written to the primary only is reported
+	_, err = primary.Set(ctx, "k2", "v2")
+	assert.Nil(t, err)
+	p := cli.Pipeline()
+	p.Get("k2")
+	res, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", *res[0].(*string))
+	select {
+	case m := <-mismatches:
+		assert.Equal(t, [][]string{{"GET", "k2"}}, m.Requests)
+		assert.Equal(t, res, m.Primary)
+		assert.Equal(t, []interface{}{(*string)(nil)}, m.Shadow)
+	case <-time.After(time.Second):
+		t.Fatal("no mismatch reported")
+	}
+
+	// Shutdown sends the queued commands, in order for each key
+	_, err = cli.Del(ctx, "k")
+	assert.Nil(t, err)
+	assert.False(t, cli.mirrored(&genericScanCommand{}))
+	assert.Nil(t, cli.Shutdown(ctx))
+	mutex.Lock()
+	assert.ElementsMatch(t, []string{"SET k v", "GET k", "GET k2", "DEL k"}, shadowRequests)
+	order := strings.Join(shadowRequests, ",")
+	assert.Less(t, strings.Index(order, "SET k v"), strings.Index(order, "GET k,"))
+	assert.Less(t, strings.Index(order, "GET k,"), strings.Index(order, "DEL k"))
+	mutex.Unlock()
+	assert.Empty(t, mismatches)
+
+	_, err = NewMirrorClient(&MirrorConfig{Primary: primary})
+	assert.ErrorIs(t, err, ErrGodis)
+}
+
+func TestMirrorClientSkipsAndDrops(t *testing.T) {
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	var shadowRequests []string
+	shadowServer := newFakeServer(t, func(args []string) string {
+		<-release
+		mutex.Lock()
+		shadowRequests = append(shadowRequests, strings.Join(args, " "))
+		mutex.Unlock()
+		return "+OK\r\n"
+	})
+	primary, err := NewClient(&ClientConfig{Address: newFakeServer(t, kvHandler()).Addr()})
+	assert.Nil(t, err)
+	shadow, err := NewClient(&ClientConfig{Address: shadowServer.Addr()})
+	assert.Nil(t, err)
+	cli, err := NewMirrorClient(&MirrorConfig{Primary: primary, Shadow: shadow, Workers: 1, QueueSize: 1})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	// The worker blocks on the first command and the second fills the queue,
+	// the third is dropped
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_, err = cli.Set(ctx, k, "v")
+		assert.Nil(t, err)
+		if k == "k1" {
+			assert.Eventually(t, func() bool { return len(cli.queues[0]) == 0 }, time.Second, time.Millisecond)
+		}
+	}
+	assert.Equal(t, uint64(1), cli.Dropped())
+
+	// A command the primary didn't execute isn't mirrored
+	assert.Nil(t, primary.Close())
+	_, err = cli.Set(ctx, "k4", "v")
+	assert.ErrorIs(t, err, ErrClosedPool)
+	assert.Equal(t, uint64(1), cli.Dropped())
+
+	close(release)
+	assert.Nil(t, cli.Shutdown(ctx))
+	mutex.Lock()
+	assert.Equal(t, []string{"SET k1 v", "SET k2 v"}, shadowRequests)
+	mutex.Unlock()
+}
@@ -65,6 +65,21 @@ func (mr *MockProtocolMockRecorder) ReadArray(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadArray", reflect.TypeOf((*MockProtocol)(nil).ReadArray), arg0)
 }
 
+// ReadArrayLen mocks base method.
+func (m *MockProtocol) ReadArrayLen(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadArrayLen", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadArrayLen indicates an expected call of ReadArrayLen.
+func (mr *MockProtocolMockRecorder) ReadArrayLen(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadArrayLen", reflect.TypeOf((*MockProtocol)(nil).ReadArrayLen), arg0)
+}
+
 // ReadBulkString mocks base method.
 func (m *MockProtocol) ReadBulkString(arg0 context.Context) (*[]byte, error) {
 	m.ctrl.T.Helper()
@@ -368,3 +383,17 @@ func (mr *MockConnectionPoolMockRecorder) Release(arg0 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockConnectionPool)(nil).Release), arg0)
 }
+
+// Shutdown mocks base method.
+func (m *MockConnectionPool) Shutdown(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shutdown", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockConnectionPoolMockRecorder) Shutdown(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockConnectionPool)(nil).Shutdown), arg0)
+}
@@ -0,0 +1,492 @@
+package godis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// multiplexPool is a ConnectionPool that pushes the commands of every caller
+// through a fixed number of sockets. GetConnection returns a virtual
+// connection which buffers the request and receives exactly its own replies.
+type multiplexPool struct {
+	config  *ConnectionConfig
+	muxes   []*multiplexer
+	next    uint32
+	mutex   sync.Mutex
+	closed  bool
+	inUse   uint
+	drained chan struct{}
+}
+
+func newMultiplexPool(config *ConnectionConfig, conNum uint, writeTimeout time.Duration) ConnectionPool {
+	config.initAddresses()
+	p := &multiplexPool{config: config, muxes: make([]*multiplexer, 0, conNum)}
+	for i := uint(0); i < conNum; i++ {
+		p.muxes = append(p.muxes, &multiplexer{config: config, newConnection: NewConnection, writeTimeout: writeTimeout})
+	}
+	return p
+}
+
+func (p *multiplexPool) GetConnection() (Connection, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil, ErrClosedPool
+	}
+	p.inUse++
+	i := atomic.AddUint32(&p.next, 1)
+	return &muxConnection{mux: p.muxes[int(i)%len(p.muxes)], lastUsedAt: time.Now()}, nil
+}
+
+func (p *multiplexPool) Release(Connection) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.inUse == 0 {
+		return ErrClosedPool
+	}
+	p.inUse--
+	if p.closed && p.inUse == 0 {
+		p.closeSockets()
+		close(p.drained)
+	}
+	return nil
+}
+
+func (p *multiplexPool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	p.config.closeAddresses()
+	p.drained = make(chan struct{})
+	if p.inUse == 0 {
+		p.closeSockets()
+		close(p.drained)
+	}
+	return nil
+}
+
+func (p *multiplexPool) Shutdown(ctx context.Context) error {
+	if err := p.Close(); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	drained := p.drained
+	p.mutex.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.inUse == 0 {
+		return nil
+	}
+	p.closeSockets()
+	p.inUse = 0
+	close(p.drained)
+	return ctx.Err()
+}
+
+func (p *multiplexPool) closeSockets() {
+	for _, m := range p.muxes {
+		m.close()
+	}
+}
+
+// multiplexer shares one connection between many goroutines. Requests are
+// written in the order they arrive and the replies are handed back to their
+// senders in the same (FIFO) order.
+type multiplexer struct {
+	config        *ConnectionConfig
+	newConnection func(*ConnectionConfig) Connection
+	// The maximum time of a write, after which the socket fails.
+	writeTimeout time.Duration
+	mutex        sync.Mutex
+	socket       *muxSocket
+	// The dial in progress, if any.
+	dial   *muxDial
+	closed bool
+}
+
+type muxDial struct {
+	done chan struct{}
+	err  error
+}
+
+// send writes a buffer holding n requests and returns the channel on which
+// their replies will be delivered.
+func (m *multiplexer) send(ctx context.Context, data []byte, n int) (<-chan muxReply, error) {
+	s, err := m.getSocket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies := make(chan muxReply, n)
+	if err := s.write(ctx, data, &muxWaiter{replies: replies, remain: n}, m.writeTimeout); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// getSocket returns the socket, dialed without the mutex by the first caller
+// that finds it missing or broken. The other callers wait for the dial until
+// ctx is done.
+func (m *multiplexer) getSocket(ctx context.Context) (*muxSocket, error) {
+	for {
+		m.mutex.Lock()
+		if m.closed {
+			m.mutex.Unlock()
+			return nil, ErrClosedPool
+		}
+		if s := m.socket; s != nil && !s.isBroken() {
+			m.mutex.Unlock()
+			return s, nil
+		}
+		if d := m.dial; d != nil {
+			m.mutex.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-d.done:
+			}
+			if d.err != nil {
+				return nil, d.err
+			}
+			continue
+		}
+		d := &muxDial{done: make(chan struct{})}
+		m.dial = d
+		m.mutex.Unlock()
+
+		con := m.newConnection(m.config)
+		d.err = con.Connect()
+
+		m.mutex.Lock()
+		m.dial = nil
+		if d.err == nil && m.closed {
+			d.err = ErrClosedPool
+			if err := con.Close(); err != nil {
+				log.Println("failed to close connection: ", err)
+			}
+		}
+		if d.err == nil {
+			m.socket = newMuxSocket(con)
+			go m.socket.readLoop()
+		}
+		m.mutex.Unlock()
+		close(d.done)
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+}
+
+func (m *multiplexer) close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = true
+	if m.socket != nil {
+		m.socket.fail(ErrClosedPool)
+		m.socket = nil
+	}
+}
+
+type muxReply struct {
+	data []byte
+	err  error
+}
+
+type muxWaiter struct {
+	replies chan muxReply
+	remain  int
+}
+
+// muxSocket is a connection owned by a multiplexer together with the queue
+// of the callers waiting for its replies.
+type muxSocket struct {
+	con Connection
+	// Held by the caller writing, a channel so that the others can give up.
+	writeLock chan struct{}
+	mutex     sync.Mutex
+	waiters   []*muxWaiter
+	err       error
+}
+
+func newMuxSocket(con Connection) *muxSocket {
+	return &muxSocket{con: con, writeLock: make(chan struct{}, 1)}
+}
+
+// write enqueues w then writes data, so that the reader never gets a reply
+// without its waiter. The deadline of the caller is not applied to the shared
+// socket, a caller gives up by no longer waiting for its replies, but a write
+// taking longer than timeout fails the socket.
+func (s *muxSocket) write(ctx context.Context, data []byte, w *muxWaiter, timeout time.Duration) error {
+	select {
+	case s.writeLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.writeLock }()
+
+	if err := s.enqueue(w); err != nil {
+		return err
+	}
+	writeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := s.con.Write(writeCtx, data); err != nil {
+		s.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (s *muxSocket) isBroken() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err != nil
+}
+
+func (s *muxSocket) enqueue(w *muxWaiter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.waiters = append(s.waiters, w)
+	return nil
+}
+
+func (s *muxSocket) readLoop() {
+	r := bufio.NewReader(&connectionReader{con: s.con})
+	for {
+		data, err := readRawReply(r)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		if err := s.deliver(data); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+func (s *muxSocket) deliver(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.waiters) == 0 {
+		return errors.Wrap(errUnexpectedRes, "reply without a waiting request")
+	}
+	w := s.waiters[0]
+	w.replies <- muxReply{data: data}
+	w.remain--
+	if w.remain == 0 {
+		s.waiters[0] = nil
+		s.waiters = s.waiters[1:]
+	}
+	return nil
+}
+
+// fail breaks the socket and hands err to every waiting caller.
+func (s *muxSocket) fail(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	if err := s.con.Close(); err != nil {
+		log.Println("failed to close connection: ", err)
+	}
+	for _, w := range s.waiters {
+		// A waiter has room for all its replies, so this never blocks.
+		w.replies <- muxReply{err: err}
+	}
+	s.waiters = nil
+}
+
+// muxConnection is the virtual connection handed out by multiplexPool. Writes
+// are buffered until the first read, then sent as one request batch.
+type muxConnection struct {
+	mux        *multiplexer
+	wbuf       []byte
+	rbuf       []byte
+	replies    <-chan muxReply
+	pending    int
+	lastUsedAt time.Time
+	broken     bool
+}
+
+func (c *muxConnection) Write(ctx context.Context, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	c.wbuf = append(c.wbuf, p...)
+	return len(p), nil
+}
+
+func (c *muxConnection) Read(ctx context.Context, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(c.rbuf) == 0 {
+		if err := c.flush(ctx); err != nil {
+			return 0, err
+		}
+		if c.pending == 0 {
+			return 0, io.EOF
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case r := <-c.replies:
+			c.pending--
+			if r.err != nil {
+				return 0, errors.Wrap(r.err, "failed to read from connection")
+			}
+			c.rbuf = r.data
+		}
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	c.lastUsedAt = time.Now()
+	return n, nil
+}
+
+func (c *muxConnection) flush(ctx context.Context) error {
+	if len(c.wbuf) == 0 {
+		return nil
+	}
+	if c.pending != 0 {
+		return errors.New("previous replies have not been read")
+	}
+	n, err := countRequests(c.wbuf)
+	if err != nil {
+		return err
+	}
+	replies, err := c.mux.send(ctx, c.wbuf, n)
+	if err != nil {
+		return err
+	}
+	c.wbuf = nil
+	c.replies = replies
+	c.pending = n
+	return nil
+}
+
+func (c *muxConnection) GetLastUsedAt() time.Time {
+	return c.lastUsedAt
+}
+
+func (c *muxConnection) IsBroken() bool {
+	return c.broken
+}
+
+func (c *muxConnection) SetBroken() {
+	c.broken = true
+}
+
+func (c *muxConnection) Connect() error {
+	return nil
+}
+
+func (c *muxConnection) Close() error {
+	return nil
+}
+
+// connectionReader adapts a Connection to io.Reader.
+type connectionReader struct {
+	con Connection
+}
+
+func (r *connectionReader) Read(p []byte) (int, error) {
+	return r.con.Read(context.Background(), p)
+}
+
+func countRequests(data []byte) (int, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	n := 0
+	for {
+		if _, err := r.Peek(1); err == io.EOF {
+			return n, nil
+		}
+		if _, err := readRawReply(r); err != nil {
+			return 0, errors.Wrap(err, "invalid request")
+		}
+		n++
+	}
+}
+
+// readRawReply reads one complete RESP value and returns its raw bytes.
+func readRawReply(r *bufio.Reader) ([]byte, error) {
+	var raw []byte
+	if err := appendRawReply(r, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func appendRawReply(r *bufio.Reader, raw *[]byte) error {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	*raw = append(*raw, line...)
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return errors.WithStack(errInvalidMsg)
+	}
+
+	var n int64
+	switch line[0] {
+	case bulkStringPrefix, '!', '=':
+		n, err = strconv.ParseInt(string(line[1:len(line)-2]), 10, 64)
+		if err != nil {
+			return errors.Wrap(errInvalidMsg, "invalid bulk string length")
+		}
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		*raw = append(*raw, buf...)
+		return nil
+	case arrayPrefix, mapPrefix, '~':
+		n, err = strconv.ParseInt(string(line[1:len(line)-2]), 10, 64)
+		if err != nil {
+			return errors.Wrap(errInvalidMsg, "invalid aggregate length")
+		}
+		if line[0] == mapPrefix {
+			n *= 2
+		}
+		for i := int64(0); i < n; i++ {
+			if err := appendRawReply(r, raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+}
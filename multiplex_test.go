@@ -0,0 +1,179 @@
+package godis
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRawReply(t *testing.T) {
+	in := "+OK\r\n$5\r\nhello\r\n$-1\r\n*2\r\n:1\r\n*1\r\n$1\r\na\r\n%1\r\n+k\r\n_\r\n-ERR bad\r\n"
+	r := bufio.NewReader(strings.NewReader(in))
+	var out []string
+	for i := 0; i < 6; i++ {
+		raw, err := readRawReply(r)
+		assert.Nil(t, err)
+		out = append(out, string(raw))
+	}
+	assert.Equal(t, []string{"+OK\r\n", "$5\r\nhello\r\n", "$-1\r\n", "*2\r\n:1\r\n*1\r\n$1\r\na\r\n", "%1\r\n+k\r\n_\r\n", "-ERR bad\r\n"}, out)
+
+	n, err := countRequests([]byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n*1\r\n$4\r\nPING\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestMultiplexedClient(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	cli, err := NewClient(&ClientConfig{Address: server.Addr(), MultiplexConns: 1})
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			k, v := "k"+strconv.Itoa(i), "v"+strconv.Itoa(i)
+			ok, err := cli.Set(ctx, k, v)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			r, err := cli.Get(ctx, k)
+			assert.Nil(t, err)
+			assert.Equal(t, v, *r)
+		}(i)
+	}
+	wg.Wait()
+
+	// Error replies only fail their own command
+	_, err = cli.GetDel(ctx, "k1")
+	assert.Equal(t, "ERR", err.(Error).Type)
+
+	p := cli.Pipeline()
+	p.Incr("n")
+	p.Incr("n")
+	p.Get("k1")
+	res, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res[1])
+	assert.Equal(t, "v1", *res[2].(*string))
+
+	assert.Equal(t, 1, server.ConNum())
+	assert.Nil(t, cli.Shutdown(ctx))
+	_, err = cli.Get(ctx, "k1")
+	assert.ErrorIs(t, err, ErrClosedPool)
+}
+
+func TestMultiplexedClientCanceledWaiter(t *testing.T) {
+	replies := make(chan string)
+	server := newFakeServer(t, func(args []string) string {
+		return <-replies
+	})
+	cli, err := NewClient(&ClientConfig{Address: server.Addr(), MultiplexConns: 1})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = cli.Get(ctx, "slow")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The late reply is dropped and the next caller gets its own reply
+	go func() {
+		replies <- "$4\r\nlate\r\n"
+		replies <- "$4\r\nmine\r\n"
+	}()
+	r, err := cli.Get(context.Background(), "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "mine", *r)
+}
+
+// stallConnection is a Connection whose Connect waits for connected, whose
+// writes wait for their deadline and whose reads wait for Close.
+type stallConnection struct {
+	connected chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newStallConnection(connected chan struct{}) *stallConnection {
+	return &stallConnection{connected: connected, closed: make(chan struct{})}
+}
+
+func (c *stallConnection) Connect() error {
+	<-c.connected
+	return nil
+}
+
+func (c *stallConnection) Write(ctx context.Context, p []byte) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-c.closed:
+		return 0, ErrClosedConn
+	}
+}
+
+func (c *stallConnection) Read(ctx context.Context, p []byte) (int, error) {
+	<-c.closed
+	return 0, ErrClosedConn
+}
+
+func (c *stallConnection) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *stallConnection) GetLastUsedAt() time.Time { return time.Time{} }
+func (c *stallConnection) IsBroken() bool           { return false }
+func (c *stallConnection) SetBroken()               {}
+
+func TestMultiplexerStalledServer(t *testing.T) {
+	connected := make(chan struct{})
+	m := &multiplexer{
+		newConnection: func(*ConnectionConfig) Connection {
+			return newStallConnection(connected)
+		},
+		writeTimeout: 20 * time.Millisecond,
+	}
+	req := []byte("*1\r\n$4\r\nPING\r\n")
+
+	// A caller waiting for the dial of another one gives up with its context,
+	// and close doesn't wait for the dial
+	dialed := make(chan error, 1)
+	go func() {
+		_, err := m.send(context.Background(), req, 1)
+		dialed <- err
+	}()
+	assert.Eventually(t, func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		return m.dial != nil
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := m.send(ctx, req, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	m.close()
+	close(connected)
+	assert.ErrorIs(t, <-dialed, ErrClosedPool)
+
+	// A stalled write fails the socket once the write timeout is reached
+	m = &multiplexer{
+		newConnection: func(*ConnectionConfig) Connection {
+			return newStallConnection(connected)
+		},
+		writeTimeout: 20 * time.Millisecond,
+	}
+	defer m.close()
+	_, err = m.send(context.Background(), req, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	m.mutex.Lock()
+	assert.True(t, m.socket.isBroken())
+	m.mutex.Unlock()
+}
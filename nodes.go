@@ -0,0 +1,156 @@
+package godis
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// nodeRegistry holds the clients of the nodes of a client made of several
+// servers, created on first use, and runs its background loops. Closing it
+// cancels the context of the loops and closes the clients without waiting for
+// a refresh in flight, which fails once its node is closed.
+type nodeRegistry struct {
+	newNode func(addr string) *client
+
+	mutex  sync.Mutex
+	nodes  map[string]*client
+	closed bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newNodeRegistry(config *ClientConfig) *nodeRegistry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &nodeRegistry{
+		newNode: func(addr string) *client {
+			cfg := config.withAddress(addr)
+			return newClient(cfg, cfg.newConnectionPool())
+		},
+		nodes:  make(map[string]*client),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// node returns the client of the node at addr.
+func (r *nodeRegistry) node(addr string) (*client, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil, ErrClosedPool
+	}
+	node, ok := r.nodes[addr]
+	if !ok {
+		node = r.newNode(addr)
+		r.nodes[addr] = node
+	}
+	return node, nil
+}
+
+// retain closes the clients of the nodes that are not in keep.
+func (r *nodeRegistry) retain(keep map[string]bool) {
+	r.mutex.Lock()
+	var removed []*client
+	for addr, node := range r.nodes {
+		if !keep[addr] {
+			delete(r.nodes, addr)
+			removed = append(removed, node)
+		}
+	}
+	r.mutex.Unlock()
+
+	for _, node := range removed {
+		if err := node.Close(); err != nil {
+			log.Println("failed to close node: ", err)
+		}
+	}
+}
+
+// remove closes the client of the node at addr.
+func (r *nodeRegistry) remove(addr string) {
+	r.mutex.Lock()
+	node, ok := r.nodes[addr]
+	delete(r.nodes, addr)
+	r.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+	if err := node.Close(); err != nil {
+		log.Println("failed to close node: ", err)
+	}
+}
+
+func (r *nodeRegistry) isClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.closed
+}
+
+// removed reports whether err comes from a node that was removed while a
+// command was routed to it, in which case the command can be routed again.
+func (r *nodeRegistry) removed(err error) bool {
+	return errors.Is(err, ErrClosedPool) && !r.isClosed()
+}
+
+// run runs loop in the background until the registry is closed, which
+// cancels its context.
+func (r *nodeRegistry) run(loop func(ctx context.Context)) {
+	go loop(r.ctx)
+}
+
+// close stops the background loops and closes the client of every node with
+// closeNode. It does nothing if the registry was already closed.
+func (r *nodeRegistry) close(closeNode func(*client) error) error {
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	nodes := r.nodes
+	r.nodes = nil
+	r.mutex.Unlock()
+
+	r.cancel()
+	var err error
+	for addr, node := range nodes {
+		if err1 := closeNode(node); err1 != nil && err == nil {
+			err = errors.Wrap(err1, "failed to close node "+addr)
+		}
+	}
+	return err
+}
+
+// forEach calls fn concurrently with the client of every node of addrs. The
+// errors are gathered in a *ClusterError.
+func (r *nodeRegistry) forEach(ctx context.Context, addrs []string, fn func(ctx context.Context, addr string, node Client) error) error {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			node, err := r.node(addr)
+			if err == nil {
+				err = fn(ctx, addr, node)
+			}
+			if err != nil {
+				mutex.Lock()
+				errs[addr] = err
+				mutex.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return &ClusterError{Errors: errs}
+	}
+	return nil
+}
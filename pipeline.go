@@ -1,144 +1,205 @@
 package godis
 
-import "context"
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
 
 type Pipeline struct {
-	client   *client
+	exec     cmdable
 	commands []Command
+	// The typed results of the commands, filled in by Exec.
+	results []pipelineCmd
+	// Send the commands in a MULTI/EXEC transaction, see TxPipeline.
+	tx bool
+	// Bound to a Conn, whose WATCHed keys Discard unwatches.
+	dedicated bool
+}
+
+func (p *Pipeline) add(cmd Command, res pipelineCmd) {
+	p.commands = append(p.commands, cmd)
+	p.results = append(p.results, res)
+}
+
+// Discard drops the queued commands. The commands of a transaction are only
+// sent by Exec, but for a transaction on a Conn Discard still sends MULTI and
+// DISCARD, which unwatches the keys, e.g. to abort the transaction of Watch.
+func (p *Pipeline) Discard(ctx context.Context) error {
+	p.commands, p.results = nil, nil
+	if !p.tx || !p.dedicated {
+		return nil
+	}
+	_, err := p.exec(ctx, &discardCommand{})
+	return err
 }
 
+// Exec sends the commands and returns their results in order, which are also
+// set in the results returned when the commands were queued. If some of the
+// commands failed, the error is a *PipelineError and the results of the other
+// commands are still returned.
 func (p *Pipeline) Exec(ctx context.Context) ([]interface{}, error) {
-	r, err := p.client.exec(ctx, p)
-	if err != nil {
-		return nil, err
+	var cmd Command = p
+	if p.tx {
+		cmd = &txCommand{commands: p.commands}
 	}
-	return r.([]interface{}), nil
-}
-
-func (p *Pipeline) SendReq(ctx context.Context, protocol Protocol) error {
-	for _, cmd := range p.commands {
-		err := cmd.SendReq(ctx, protocol)
-		if err != nil {
-			return err
+	r, err := p.exec(ctx, cmd)
+	res, ok := r.([]interface{})
+	if err == nil && !ok {
+		err = errors.WithStack(errUnexpectedRes)
+	}
+	var pe *PipelineError
+	if err != nil && (!ok || !errors.As(err, &pe)) {
+		for _, res := range p.results {
+			res.set(nil, err)
 		}
+		return nil, err
 	}
-	return nil
-}
-
-func (p *Pipeline) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
-	var res []interface{}
-	for _, cmd := range p.commands {
-		r, err := cmd.ReadResp(ctx, protocol)
-		if err != nil {
-			return nil, err
+	for i, cmdRes := range p.results {
+		var cmdErr error
+		if pe != nil {
+			cmdErr = pe.Errors[i]
 		}
-		res = append(res, r)
+		cmdRes.set(res[i], cmdErr)
 	}
-	return res, nil
-}
-
-func (c *client) Pipeline() *Pipeline {
-	return &Pipeline{client: c}
-}
-
-// String commands
-
-func (p *Pipeline) Append(key string, value string) {
-	p.commands = append(p.commands, &stringAppendCommand{key: key, value: value})
-}
-
-func (p *Pipeline) Decr(key string) {
-	p.commands = append(p.commands, &stringDecrCommand{key: key})
-}
-
-func (p *Pipeline) DecrBy(key string, decrement int64) {
-	p.commands = append(p.commands, &stringDecrByCommand{key: key, decrement: decrement})
-}
-
-func (p *Pipeline) Get(key string) {
-	p.commands = append(p.commands, &stringGetCommand{key: key})
-}
-
-func (p *Pipeline) GetDel(key string) {
-	p.commands = append(p.commands, &stringGetDelCommand{key: key})
-}
-
-func (p *Pipeline) GetEX(key string, optArgs ...arg) {
-	p.commands = append(p.commands, &stringGetEXCommand{key: key})
-}
-
-func (p *Pipeline) Lcs(key1 string, key2 string, args ...arg) {
-	p.commands = append(p.commands, &stringLcsCommand{key1: key1, key2: key2, args: args})
-}
-
-func (p *Pipeline) LcsLen(key1 string, key2 string) {
-	p.commands = append(p.commands, &stringLcsLenCommand{key1: key1, key2: key2})
-}
-
-func (p *Pipeline) LcsIdx(key1 string, key2 string, args ...arg) {
-	p.commands = append(p.commands, &stringLcsIdxCommand{key1: key1, key2: key2, args: args})
-}
-
-func (p *Pipeline) LcsIdxWithMatchLen(key1 string, key2 string, args ...arg) {
-	p.commands = append(p.commands, &stringLcsIdxWithMatchLenCommand{key1: key1, key2: key2, args: args})
+	return res, err
 }
 
-func (p *Pipeline) GetRange(key string, start int64, end int64) {
-	p.commands = append(p.commands, &stringGetRangeCommand{key: key, start: start, end: end})
+// Pipelined queues commands with fn in a pipeline and executes it, unless fn
+// returns an error.
+func (c cmdable) Pipelined(ctx context.Context, fn func(p *Pipeline) error) ([]interface{}, error) {
+	p := &Pipeline{exec: c}
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	return p.Exec(ctx)
 }
 
-func (p *Pipeline) GetSet(key string, value string) {
-	p.commands = append(p.commands, &stringGetSetCommand{key: key, value: value})
+// PipelineError is returned by Exec when some of the commands of a pipeline
+// failed, e.g. with an error reply. It unwraps to the first error.
+type PipelineError struct {
+	// The error of each command, nil for the commands that succeeded.
+	Errors []error
 }
 
-func (p *Pipeline) Incr(key string) {
-	p.commands = append(p.commands, &stringIncrCommand{key: key})
+func (e *PipelineError) Error() string {
+	failed := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return strconv.Itoa(failed) + " of " + strconv.Itoa(len(e.Errors)) + " pipeline commands failed, first: " + e.Unwrap().Error()
 }
 
-func (p *Pipeline) IncrBy(key string, increment int64) {
-	p.commands = append(p.commands, &stringIncrByCommand{key: key, increment: increment})
+func (e *PipelineError) Unwrap() error {
+	for _, err := range e.Errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (p *Pipeline) IncrByFloat(key string, increment float64) {
-	p.commands = append(p.commands, &stringIncrByFloatCommand{key: key, increment: increment})
+// pipelineResult returns the results of a pipeline and a *PipelineError if
+// some of its commands failed.
+func pipelineResult(res []interface{}, errs []error) (interface{}, error) {
+	for _, err := range errs {
+		if err != nil {
+			return res, &PipelineError{Errors: errs}
+		}
+	}
+	return res, nil
 }
 
-func (p *Pipeline) MGet(keys ...string) {
-	p.commands = append(p.commands, &stringMGetCommand{keys: keys})
+func (p *Pipeline) SendReq(ctx context.Context, protocol Protocol) error {
+	for _, cmd := range p.commands {
+		err := cmd.SendReq(ctx, protocol)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (p *Pipeline) MSet(kvs map[string]string) {
-	p.commands = append(p.commands, &stringMSetCommand{kvs: kvs})
+// ReadResp reads the reply of every command, an error reply only fails its
+// command.
+func (p *Pipeline) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	res, errs, err := readResps(ctx, protocol, p.commands)
+	if err != nil {
+		return nil, err
+	}
+	return pipelineResult(res, errs)
+}
+
+// readResps reads the replies of commands, keeping their error replies. It
+// stops on the other errors, which leave the connection unusable.
+func readResps(ctx context.Context, protocol Protocol, commands []Command) ([]interface{}, []error, error) {
+	res := make([]interface{}, len(commands))
+	errs := make([]error, len(commands))
+	for i, cmd := range commands {
+		r, err := readResp(ctx, protocol, cmd)
+		var e Error
+		if err != nil && !errors.As(err, &e) {
+			return nil, nil, err
+		}
+		res[i], errs[i] = r, err
+	}
+	return res, errs, nil
 }
 
-func (p *Pipeline) MSetNX(kvs map[string]string) {
-	p.commands = append(p.commands, &stringMSetNxCommand{kvs: kvs})
+func (p *Pipeline) Idempotent() bool {
+	for _, cmd := range p.commands {
+		if !isIdempotent(cmd) {
+			return false
+		}
+	}
+	return true
 }
 
-func (p *Pipeline) PSetEX(key, value string, milliseconds uint64) {
-	p.commands = append(p.commands, &stringPSetEXCommand{key: key, value: value, milliseconds: milliseconds})
+func (p *Pipeline) ReadOnly() bool {
+	for _, cmd := range p.commands {
+		if !isReadOnly(cmd) {
+			return false
+		}
+	}
+	return len(p.commands) > 0
 }
 
-func (p *Pipeline) Set(key string, value string, args ...arg) {
-	p.commands = append(p.commands, &stringSetCommand{key: key, value: value, args: args})
+// batchCommand is implemented by the commands sending the requests of several
+// commands, which read the error replies of each command themselves.
+type batchCommand interface {
+	Batch() bool
 }
 
-func (p *Pipeline) SetEX(key, value string, seconds uint64) {
-	p.commands = append(p.commands, &stringSetEXCommand{key: key, value: value, seconds: seconds})
+func (p *Pipeline) Batch() bool {
+	return true
 }
 
-func (p *Pipeline) SetNX(key, value string) {
-	p.commands = append(p.commands, &stringSetNXCommand{key: key, value: value})
+func isBatch(cmd Command) bool {
+	c, ok := cmd.(batchCommand)
+	return ok && c.Batch()
 }
 
-func (p *Pipeline) SetRange(key string, offset uint, value string) {
-	p.commands = append(p.commands, &stringSetRangeCommand{key: key, value: value, offset: offset})
+// commandBatch is a pipeline whose error replies are kept per command, so
+// that a failed command doesn't fail the others. It batches the commands of
+// different callers, or of different slots in cluster mode.
+type commandBatch struct {
+	*Pipeline
+	res  []interface{}
+	errs []error
 }
 
-func (p *Pipeline) StrLen(key string) {
-	p.commands = append(p.commands, &stringStrLenCommand{key: key})
+func (b *commandBatch) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	res, errs, err := readResps(ctx, protocol, b.commands)
+	if err != nil {
+		return nil, err
+	}
+	b.res, b.errs = res, errs
+	return b.res, nil
 }
 
-func (p *Pipeline) SubStr(key string, start, end int) {
-	p.commands = append(p.commands, &stringSubStrCommand{key: key, start: start, end: end})
+func (c *client) Pipeline() *Pipeline {
+	return &Pipeline{exec: c.exec}
 }
@@ -42,6 +42,9 @@ type Protocol interface {
 	ReadInteger(ctx context.Context) (int64, error)
 	ReadNull(ctx context.Context) error
 	ReadArray(ctx context.Context) ([]interface{}, error)
+	// ReadArrayLen reads the header of an array, its elements are read by the
+	// caller. It returns -1 for a null array.
+	ReadArrayLen(ctx context.Context) (int, error)
 	ReadMap(ctx context.Context) ([]interface{}, error)
 
 	WriteBulkString(ctx context.Context, bs []byte) error
@@ -150,13 +153,36 @@ func (p *respProtocol) ReadBulkString(ctx context.Context) (*[]byte, error) {
 		return nil, nil
 	}
 
-	rec, err := p.readBeforeTerminator(ctx)
+	rec, err := p.readBulk(ctx, strLen)
 	if err != nil {
 		return nil, err
 	}
 	return &rec, nil
 }
 
+// readBulk reads n bytes and the terminator after them. The bytes may contain
+// terminators, e.g. the lines of INFO.
+func (p *respProtocol) readBulk(ctx context.Context, n int) ([]byte, error) {
+	rec := make([]byte, p.hasRecLen)
+	copy(rec, p.buf[:p.hasRecLen])
+	p.hasRecLen = 0
+
+	var err error
+	var m int
+	for err == nil && len(rec) < n+len(terminator) {
+		m, err = p.con.Read(ctx, p.buf)
+		rec = append(rec, p.buf[:m]...)
+	}
+	if len(rec) < n+len(terminator) {
+		return nil, errors.Wrap(err, "failed to read from connection")
+	}
+	if !bytes.Equal(rec[n:n+len(terminator)], terminator) {
+		return nil, errors.Wrap(errInvalidMsg, "invalid bulk string terminator")
+	}
+	p.hasRecLen = copy(p.buf, rec[n+len(terminator):])
+	return rec[:n:n], nil
+}
+
 func (p *respProtocol) ReadSimpleString(ctx context.Context) ([]byte, error) {
 	// Simple string example:"+OK\r\n"
 
@@ -282,21 +308,31 @@ func (p *respProtocol) ReadNull(ctx context.Context) error {
 	return nil
 }
 
-func (p *respProtocol) ReadArray(ctx context.Context) ([]interface{}, error) {
-	// *<number-of-elements>\r\n<element-1>...<element-n>
+func (p *respProtocol) ReadArrayLen(ctx context.Context) (int, error) {
+	// *<number-of-elements>\r\n
 
 	rec, err := p.readBeforeTerminator(ctx)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	if len(rec) == 0 || rec[0] != arrayPrefix {
-		return nil, errors.Wrap(errInvalidMsg, "invalid array prefix")
+		return 0, errors.Wrap(errInvalidMsg, "invalid array prefix")
 	}
 	rec = rec[1:]
 
 	arrayLen, err := strconv.ParseInt(string(rec), 10, 64)
+	if err != nil || arrayLen < -1 {
+		return 0, errors.Wrap(errInvalidMsg, "invalid array length")
+	}
+	return int(arrayLen), nil
+}
+
+func (p *respProtocol) ReadArray(ctx context.Context) ([]interface{}, error) {
+	// *<number-of-elements>\r\n<element-1>...<element-n>
+
+	arrayLen, err := p.ReadArrayLen(ctx)
 	if err != nil {
-		return nil, errors.Wrap(errInvalidMsg, "invalid array length")
+		return nil, err
 	}
 	if arrayLen == -1 {
 		return nil, nil
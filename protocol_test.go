@@ -1,7 +1,10 @@
 package godis
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"strconv"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -81,6 +84,7 @@ func TestReadBulkString(t *testing.T) {
 		{[]byte("\nkkk1\r\n$"), []byte("kkk1")},
 		{[]byte("1\r\no\r\n"), []byte("o")},
 		{[]byte("$0\r\n\r\n"), []byte("")},
+		{[]byte("$8\r\na:1\r\nb:2\r\n"), []byte("a:1\r\nb:2")},
 	}
 
 	var proc Protocol = NewProtocol(mkCon)
@@ -114,6 +118,58 @@ func TestReadBulkString(t *testing.T) {
 	assert.Nil(t, r)
 }
 
+func TestReadBulkStringByLength(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mkCon := NewMockConnection(ctrl)
+	ctx := context.Background()
+	feed := func(chunks ...[]byte) {
+		calls := make([]*gomock.Call, 0, len(chunks))
+		for _, chunk := range chunks {
+			chunk := chunk
+			calls = append(calls, mkCon.EXPECT().Read(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, buf []byte) (int, error) {
+				return copy(buf, chunk), nil
+			}))
+		}
+		gomock.InOrder(calls...)
+	}
+
+	// A value larger than the read buffer, split across reads in the middle
+	// of its content and of its terminator
+	long := bytes.Repeat([]byte("a\r\n"), 3000)
+	msg := append([]byte("$"+strconv.Itoa(len(long))+"\r\n"), long...)
+	msg = append(msg, "\r\n+OK\r\n"...)
+	var chunks [][]byte
+	for rest := msg[:len(msg)-6]; len(rest) > 0; {
+		n := 4000
+		if n > len(rest) {
+			n = len(rest)
+		}
+		chunks, rest = append(chunks, rest[:n]), rest[n:]
+	}
+	feed(append(chunks, msg[len(msg)-6:])...)
+	var proc Protocol = NewProtocol(mkCon)
+	r, err := proc.ReadBulkString(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, long, *r)
+	ok, err := proc.ReadSimpleString(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("OK"), ok)
+
+	feed([]byte("$3\r\nabcd\r\n"))
+	_, err = NewProtocol(mkCon).ReadBulkString(ctx)
+	assert.ErrorIs(t, err, errInvalidMsg)
+
+	gomock.InOrder(
+		mkCon.EXPECT().Read(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, buf []byte) (int, error) {
+			return copy(buf, "$5\r\nab"), nil
+		}),
+		mkCon.EXPECT().Read(ctx, gomock.Any()).Return(0, io.EOF),
+	)
+	_, err = NewProtocol(mkCon).ReadBulkString(ctx)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
 func TestGetNextMsgType(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,223 @@
+package godis
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// proxyDialer connects to an address through a SOCKS5 or an HTTP CONNECT
+// proxy. Host names are resolved by the proxy.
+type proxyDialer struct {
+	proxy   *url.URL
+	dialer  *net.Dialer
+	timeout time.Duration
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy url")
+	}
+	switch u.Scheme {
+	case "socks5", "http":
+	default:
+		return nil, errors.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("invalid proxy url: missing host")
+	}
+	return u, nil
+}
+
+func newProxyDialer(rawURL string, dialer *net.Dialer) (*proxyDialer, error) {
+	u, err := parseProxyURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyDialer{proxy: u, dialer: dialer, timeout: dialer.Timeout}, nil
+}
+
+func (d *proxyDialer) Dial(network, addr string) (net.Conn, error) {
+	con, err := d.dialer.Dial(network, d.proxy.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to proxy")
+	}
+	if d.timeout > 0 {
+		if err := con.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+			con.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if d.proxy.Scheme == "socks5" {
+		err = d.socks5Connect(con, addr)
+	} else {
+		con, err = d.httpConnect(con, addr)
+	}
+	if err != nil {
+		con.Close()
+		return nil, err
+	}
+	if err := con.SetDeadline(time.Time{}); err != nil {
+		con.Close()
+		return nil, errors.WithStack(err)
+	}
+	return con, nil
+}
+
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5PasswordAuth = 0x02
+	socks5Connect      = 0x01
+	socks5IPv4         = 0x01
+	socks5Domain       = 0x03
+	socks5IPv6         = 0x04
+)
+
+// socks5Connect opens a tunnel to addr, see RFC 1928 and RFC 1929 for the
+// username/password authentication.
+func (d *proxyDialer) socks5Connect(con net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return errors.Wrap(err, "invalid port")
+	}
+
+	method := byte(socks5NoAuth)
+	if d.proxy.User != nil {
+		method = socks5PasswordAuth
+	}
+	if _, err := con.Write([]byte{socks5Version, 1, method}); err != nil {
+		return errors.Wrap(err, "socks5 greeting failed")
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(con, buf); err != nil {
+		return errors.Wrap(err, "socks5 greeting failed")
+	}
+	if buf[0] != socks5Version || buf[1] != method {
+		return errors.New("socks5 proxy refused the authentication method")
+	}
+
+	if method == socks5PasswordAuth {
+		user := d.proxy.User.Username()
+		pass, _ := d.proxy.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return errors.New("socks5 username or password too long")
+		}
+		req := []byte{0x01, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(pass)))
+		req = append(req, pass...)
+		if _, err := con.Write(req); err != nil {
+			return errors.Wrap(err, "socks5 authentication failed")
+		}
+		if _, err := io.ReadFull(con, buf); err != nil {
+			return errors.Wrap(err, "socks5 authentication failed")
+		}
+		if buf[1] != 0x00 {
+			return errors.New("socks5 authentication failed")
+		}
+	}
+
+	req := []byte{socks5Version, socks5Connect, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5 host name too long")
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5IPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5IPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err := con.Write(req); err != nil {
+		return errors.Wrap(err, "socks5 connect failed")
+	}
+
+	// VER REP RSV ATYP, followed by the bound address and port.
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(con, reply); err != nil {
+		return errors.Wrap(err, "socks5 connect failed")
+	}
+	if reply[1] != 0x00 {
+		return errors.Errorf("socks5 connect failed with code %d", reply[1])
+	}
+	var n int
+	switch reply[3] {
+	case socks5IPv4:
+		n = net.IPv4len
+	case socks5IPv6:
+		n = net.IPv6len
+	case socks5Domain:
+		if _, err := io.ReadFull(con, reply[:1]); err != nil {
+			return errors.Wrap(err, "socks5 connect failed")
+		}
+		n = int(reply[0])
+	default:
+		return errors.New("socks5 connect failed: invalid address type")
+	}
+	if _, err := io.ReadFull(con, make([]byte, n+2)); err != nil {
+		return errors.Wrap(err, "socks5 connect failed")
+	}
+	return nil
+}
+
+// httpConnect opens a tunnel to addr with the CONNECT method.
+func (d *proxyDialer) httpConnect(con net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		pass, _ := d.proxy.User.Password()
+		auth := d.proxy.User.Username() + ":" + pass
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	}
+	if err := req.Write(con); err != nil {
+		return con, errors.Wrap(err, "http connect failed")
+	}
+
+	r := bufio.NewReader(con)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return con, errors.Wrap(err, "http connect failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return con, errors.Errorf("http connect failed: %s", resp.Status)
+	}
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: con, r: r}, nil
+	}
+	return con, nil
+}
+
+// bufferedConn is a connection whose first bytes were read by r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,171 @@
+package godis
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProxy is a stand-in SOCKS5 or HTTP CONNECT proxy that accepts the
+// credentials user:pass.
+type fakeProxy struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	targets  []string
+}
+
+func newFakeProxy(t *testing.T, scheme string) *fakeProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProxy{listener: l}
+	go func() {
+		for {
+			con, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if scheme == "socks5" {
+				go p.serveSocks5(con)
+			} else {
+				go p.serveHttp(con)
+			}
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return p
+}
+
+func (p *fakeProxy) Targets() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.targets
+}
+
+func (p *fakeProxy) tunnel(con net.Conn, r io.Reader, target string) {
+	p.mutex.Lock()
+	p.targets = append(p.targets, target)
+	p.mutex.Unlock()
+
+	up, err := net.Dial("tcp", target)
+	if err != nil {
+		con.Close()
+		return
+	}
+	go func() {
+		_, _ = io.Copy(up, r)
+		up.Close()
+	}()
+	_, _ = io.Copy(con, up)
+	con.Close()
+}
+
+func (p *fakeProxy) serveSocks5(con net.Conn) {
+	r := bufio.NewReader(con)
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(r, buf); err != nil || buf[2] != socks5PasswordAuth {
+		_, _ = con.Write([]byte{socks5Version, 0xff})
+		con.Close()
+		return
+	}
+	_, _ = con.Write([]byte{socks5Version, socks5PasswordAuth})
+
+	readString := func() string {
+		n, _ := r.ReadByte()
+		s := make([]byte, n)
+		_, _ = io.ReadFull(r, s)
+		return string(s)
+	}
+	_, _ = r.ReadByte()
+	user, pass := readString(), readString()
+	if user != "user" || pass != "pass" {
+		_, _ = con.Write([]byte{0x01, 0x01})
+		con.Close()
+		return
+	}
+	_, _ = con.Write([]byte{0x01, 0x00})
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		con.Close()
+		return
+	}
+	atyp, _ := r.ReadByte()
+	var host string
+	switch atyp {
+	case socks5Domain:
+		host = readString()
+	case socks5IPv4:
+		ip := make([]byte, net.IPv4len)
+		_, _ = io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	}
+	port := make([]byte, 2)
+	_, _ = io.ReadFull(r, port)
+	_, _ = con.Write([]byte{socks5Version, 0x00, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	p.tunnel(con, r, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+}
+
+func (p *fakeProxy) serveHttp(con net.Conn) {
+	r := bufio.NewReader(con)
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		con.Close()
+		return
+	}
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != auth {
+		_, _ = io.WriteString(con, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		con.Close()
+		return
+	}
+	_, _ = io.WriteString(con, "HTTP/1.1 200 Connection established\r\n\r\n")
+	p.tunnel(con, r, req.Host)
+}
+
+func TestProxy(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	_, port, _ := net.SplitHostPort(server.Addr())
+	target := "localhost:" + port
+
+	for _, scheme := range []string{"socks5", "http"} {
+		t.Run(scheme, func(t *testing.T) {
+			proxy := newFakeProxy(t, scheme)
+			ctx := context.Background()
+
+			cli, err := NewClient(&ClientConfig{
+				Address: target,
+				Proxy:   scheme + "://user:pass@" + proxy.listener.Addr().String(),
+			})
+			assert.Nil(t, err)
+			defer cli.Close()
+			_, err = cli.Set(ctx, "k", "v")
+			assert.Nil(t, err)
+			v, err := cli.Get(ctx, "k")
+			assert.Nil(t, err)
+			assert.Equal(t, "v", *v)
+			assert.Equal(t, []string{target}, proxy.Targets())
+
+			cli, err = NewClient(&ClientConfig{
+				Address: target,
+				Proxy:   scheme + "://user:wrong@" + proxy.listener.Addr().String(),
+			})
+			assert.Nil(t, err)
+			defer cli.Close()
+			_, err = cli.Get(ctx, "k")
+			assert.NotNil(t, err)
+		})
+	}
+
+	_, err := NewClient(&ClientConfig{Address: target, Proxy: "ftp://127.0.0.1:21"})
+	assert.ErrorIs(t, err, ErrGodis)
+}
@@ -0,0 +1,334 @@
+package godis
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultReplicaCheckInterval = time.Second
+
+// ReplicaStrategy chooses the replica serving a read.
+type ReplicaStrategy int
+
+const (
+	ReplicaRandom ReplicaStrategy = iota
+	ReplicaRoundRobin
+	// The replica with the lowest round trip time to the last check.
+	ReplicaLowestLatency
+)
+
+type ReplicaConfig struct {
+	// The primary is Address or Addresses. The other settings apply to the
+	// connections to the primary and to every replica.
+	ClientConfig
+	// The addresses of the replicas. When empty, the replicas are discovered
+	// with ROLE on the primary.
+	ReplicaAddrs []string
+	Strategy     ReplicaStrategy
+	// The maximum replication offset, in bytes, a replica can be behind the
+	// primary and still serve reads. Zero disables the check.
+	MaxLag int64
+	// The interval between two checks of the replicas. Default is 1 second.
+	CheckInterval time.Duration
+}
+
+func (c *ReplicaConfig) check() error {
+	if err := c.ClientConfig.check(); err != nil {
+		return err
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = defaultReplicaCheckInterval
+	}
+	return nil
+}
+
+// ReplicaClient is a client of a primary and its read replicas. Read-only
+// commands are sent to a replica chosen by Strategy and the other commands
+// to the primary. The replicas are checked with ROLE in the background: the
+// ones not connected to the primary or lagging behind it serve no reads until
+// they catch up. Reads go to the primary when no replica is available.
+type ReplicaClient struct {
+	cmdable
+	config   *ReplicaConfig
+	primary  *client
+	nodes    *nodeRegistry
+	replicas *replicaSet
+
+	initOnce   sync.Once
+	checkMutex sync.Mutex
+}
+
+var _ Client = (*ReplicaClient)(nil)
+
+func NewReplicaClient(config *ReplicaConfig) (*ReplicaClient, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	c := &ReplicaClient{
+		config:  config,
+		primary: newClient(&config.ClientConfig, config.newConnectionPool()),
+		nodes:   newNodeRegistry(&config.ClientConfig),
+	}
+	c.replicas = newReplicaSet(config.Strategy, c.nodes)
+	c.cmdable = c.exec
+	c.nodes.run(c.checkLoop)
+	return c, nil
+}
+
+func (c *ReplicaClient) Pipeline() *Pipeline {
+	return &Pipeline{exec: c.exec}
+}
+
+// Conn checks a connection to the primary out of its pool.
+func (c *ReplicaClient) Conn(ctx context.Context) (*Conn, error) {
+	return c.primary.Conn(ctx)
+}
+
+func (c *ReplicaClient) Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error {
+	return c.primary.Watch(ctx, fn, keys...)
+}
+
+// Close stops checking the replicas and closes the clients of the primary and
+// the replicas.
+func (c *ReplicaClient) Close() error {
+	return c.closeNodes(func(node *client) error {
+		return node.Close()
+	})
+}
+
+func (c *ReplicaClient) Shutdown(ctx context.Context) error {
+	return c.closeNodes(func(node *client) error {
+		return node.Shutdown(ctx)
+	})
+}
+
+func (c *ReplicaClient) closeNodes(closeNode func(*client) error) error {
+	if c.nodes.isClosed() {
+		return nil
+	}
+	err := c.nodes.close(closeNode)
+	if err1 := closeNode(c.primary); err1 != nil && err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (c *ReplicaClient) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if !isReadOnly(cmd) {
+		return c.primary.exec(ctx, cmd)
+	}
+	// The replicas are checked before the first read.
+	c.initOnce.Do(func() {
+		if err := c.check(ctx); err != nil {
+			log.Println("failed to check replicas: ", err)
+		}
+	})
+	for {
+		node := c.replicas.pick()
+		if node == nil {
+			return c.primary.exec(ctx, cmd)
+		}
+		res, err := node.exec(ctx, cmd)
+		if c.nodes.removed(err) {
+			continue
+		}
+		// A read can be sent again, the primary serves it until the next
+		// check.
+		if isNodeFailure(err) && ctx.Err() == nil {
+			return c.primary.exec(ctx, cmd)
+		}
+		return res, err
+	}
+}
+
+func (c *ReplicaClient) checkLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, c.config.CheckInterval)
+		if err := c.check(checkCtx); err != nil && ctx.Err() == nil {
+			log.Println("failed to check replicas: ", err)
+		}
+		cancel()
+	}
+}
+
+// check reads the replication offset of the primary, and its replicas if
+// they are discovered, then keeps the replicas that are connected and close
+// enough to the offset.
+func (c *ReplicaClient) check(ctx context.Context) error {
+	c.checkMutex.Lock()
+	defer c.checkMutex.Unlock()
+
+	res, err := c.primary.execWithRetry(ctx, &doCommand{args: []string{"ROLE"}})
+	if err != nil {
+		return err
+	}
+	role, err := parseRole(res)
+	if err != nil {
+		return err
+	}
+	if role.role != "master" {
+		return errors.Wrap(ErrGodis, "the primary is a "+role.role)
+	}
+	addrs := c.config.ReplicaAddrs
+	if len(addrs) == 0 {
+		addrs = role.replicas
+	}
+
+	var wg sync.WaitGroup
+	checked := make([]*replicaNode, len(addrs))
+	for i, addr := range addrs {
+		node, err := c.replicas.node(addr)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(i int, addr string, node *client) {
+			defer wg.Done()
+			start := time.Now()
+			res, err := node.execWithRetry(ctx, &doCommand{args: []string{"ROLE"}})
+			latency := time.Since(start)
+			if err != nil {
+				return
+			}
+			r, err := parseRole(res)
+			if err != nil || r.role != "slave" || r.state != "connected" {
+				return
+			}
+			if c.config.MaxLag > 0 && role.offset-r.offset > c.config.MaxLag {
+				return
+			}
+			checked[i] = &replicaNode{addr: addr, node: node, latency: latency}
+		}(i, addr, node)
+	}
+	wg.Wait()
+	var active []replicaNode
+	for _, r := range checked {
+		if r != nil {
+			active = append(active, *r)
+		}
+	}
+	c.replicas.set(active, addrs)
+	return nil
+}
+
+type roleInfo struct {
+	// master or slave.
+	role string
+	// The replication offset, processed by the replica.
+	offset int64
+	// The replicas of a master.
+	replicas []string
+	// The state of the link of a replica to its master.
+	state string
+}
+
+// parseRole parses the reply of ROLE. A master replies with its offset and
+// its replicas, each given as ip, port and offset. A replica replies with the
+// ip and port of its master, its state and its offset.
+func parseRole(res interface{}) (*roleInfo, error) {
+	items, ok := res.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	r := &roleInfo{role: replyString(items[0])}
+	switch r.role {
+	case "master":
+		if len(items) != 3 {
+			return nil, errors.WithStack(errUnexpectedRes)
+		}
+		r.offset, _ = items[1].(int64)
+		replicas, _ := items[2].([]interface{})
+		for _, item := range replicas {
+			fields, ok := item.([]interface{})
+			if !ok || len(fields) < 2 {
+				return nil, errors.WithStack(errUnexpectedRes)
+			}
+			r.replicas = append(r.replicas, net.JoinHostPort(replyString(fields[0]), replyString(fields[1])))
+		}
+	case "slave":
+		if len(items) != 5 {
+			return nil, errors.WithStack(errUnexpectedRes)
+		}
+		r.state = replyString(items[3])
+		r.offset, _ = items[4].(int64)
+	}
+	return r, nil
+}
+
+type replicaNode struct {
+	addr    string
+	node    *client
+	latency time.Duration
+}
+
+// replicaSet picks the replica serving a read among the active ones. The
+// clients of the replicas are held by nodes.
+type replicaSet struct {
+	strategy ReplicaStrategy
+	nodes    *nodeRegistry
+
+	mutex  sync.Mutex
+	active []replicaNode
+	next   int
+}
+
+func newReplicaSet(strategy ReplicaStrategy, nodes *nodeRegistry) *replicaSet {
+	return &replicaSet{strategy: strategy, nodes: nodes}
+}
+
+// node returns the client of the replica at addr.
+func (s *replicaSet) node(addr string) (*client, error) {
+	return s.nodes.node(addr)
+}
+
+// set replaces the replicas serving reads and closes the clients of the
+// replicas that are not in known.
+func (s *replicaSet) set(active []replicaNode, known []string) {
+	keep := make(map[string]bool, len(known))
+	for _, addr := range known {
+		keep[addr] = true
+	}
+	s.nodes.retain(keep)
+	s.mutex.Lock()
+	s.active = active
+	s.mutex.Unlock()
+}
+
+// pick returns the client of the replica serving a read, or nil if there is
+// none.
+func (s *replicaSet) pick() *client {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.active) == 0 || s.nodes.isClosed() {
+		return nil
+	}
+	switch s.strategy {
+	case ReplicaRoundRobin:
+		s.next++
+		return s.active[s.next%len(s.active)].node
+	case ReplicaLowestLatency:
+		best := s.active[0]
+		for _, r := range s.active[1:] {
+			if r.latency < best.latency {
+				best = r
+			}
+		}
+		return best.node
+	default:
+		return s.active[rand.Intn(len(s.active))].node
+	}
+}
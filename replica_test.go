@@ -0,0 +1,121 @@
+package godis
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaClient(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string][]string)
+	offsets := make(map[string]int64)
+	var primaryAddr string
+	node := func() *fakeServer {
+		kv := kvHandler()
+		var s *fakeServer
+		s = newFakeServer(t, func(args []string) string {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if strings.ToUpper(args[0]) != "ROLE" {
+				requests[s.Addr()] = append(requests[s.Addr()], strings.Join(args, " "))
+				return kv(args)
+			}
+			if s.Addr() != primaryAddr {
+				host, port, _ := net.SplitHostPort(primaryAddr)
+				return respArray(respBulk("slave"), respBulk(host), respBulk(port), respBulk("connected"), respInt(int(offsets[s.Addr()])))
+			}
+			var replicas []string
+			for addr, offset := range offsets {
+				host, port, _ := net.SplitHostPort(addr)
+				replicas = append(replicas, respArray(respBulk(host), respBulk(port), respBulk(strconv.FormatInt(offset, 10))))
+			}
+			return respArray(respBulk("master"), respInt(100), respArray(replicas...))
+		})
+		return s
+	}
+	primary, upToDate, lagging := node(), node(), node()
+	primaryAddr = primary.Addr()
+	offsets[upToDate.Addr()] = 100
+	offsets[lagging.Addr()] = 10
+
+	// The replicas are discovered and the lagging one is skipped
+	cli, err := NewReplicaClient(&ReplicaConfig{ClientConfig: ClientConfig{Address: primary.Addr()}, MaxLag: 50})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+	_, err = cli.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = cli.Get(ctx, "k")
+		assert.Nil(t, err)
+	}
+	mutex.Lock()
+	assert.Equal(t, []string{"SET k v"}, requests[primary.Addr()])
+	assert.Equal(t, 4, len(requests[upToDate.Addr()]))
+	assert.Equal(t, 0, len(requests[lagging.Addr()]))
+	mutex.Unlock()
+
+	// Once it catches up, reads are spread over both replicas
+	mutex.Lock()
+	offsets[lagging.Addr()] = 100
+	requests = make(map[string][]string)
+	mutex.Unlock()
+	cli2, err := NewReplicaClient(&ReplicaConfig{
+		ClientConfig:  ClientConfig{Address: primary.Addr()},
+		ReplicaAddrs:  []string{upToDate.Addr(), lagging.Addr()},
+		Strategy:      ReplicaRoundRobin,
+		MaxLag:        50,
+		CheckInterval: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	defer cli2.Close()
+	p := cli2.Pipeline()
+	p.Get("k")
+	p.MGet("k", "k2")
+	_, err = p.Exec(ctx)
+	assert.Nil(t, err)
+	_, err = cli2.Get(ctx, "k")
+	assert.Nil(t, err)
+	mutex.Lock()
+	assert.Equal(t, []string{"GET k", "MGET k k2"}, requests[lagging.Addr()])
+	assert.Equal(t, []string{"GET k"}, requests[upToDate.Addr()])
+	mutex.Unlock()
+
+	// Reads fall back to the primary when the replicas are unavailable
+	mutex.Lock()
+	offsets[upToDate.Addr()] = 0
+	offsets[lagging.Addr()] = 0
+	mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		return cli2.replicas.pick() == nil
+	}, time.Second, 10*time.Millisecond)
+	v, err := cli2.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+}
+
+func TestParseRole(t *testing.T) {
+	b := func(s string) *[]byte {
+		bs := []byte(s)
+		return &bs
+	}
+	r, err := parseRole([]interface{}{b("master"), int64(7), []interface{}{
+		[]interface{}{b("10.0.0.1"), b("6380"), b("7")},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, &roleInfo{role: "master", offset: 7, replicas: []string{"10.0.0.1:6380"}}, r)
+
+	r, err = parseRole([]interface{}{b("slave"), b("10.0.0.2"), int64(6379), b("connected"), int64(5)})
+	assert.Nil(t, err)
+	assert.Equal(t, &roleInfo{role: "slave", offset: 5, state: "connected"}, r)
+
+	_, err = parseRole([]interface{}{b("master")})
+	assert.ErrorIs(t, err, errUnexpectedRes)
+}
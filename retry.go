@@ -0,0 +1,126 @@
+package godis
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 8 * time.Millisecond
+	defaultRetryMaxBackoff  = 512 * time.Millisecond
+)
+
+// RetryPolicy controls how commands are retried after transient failures.
+//
+// A command that failed before its request was written, or that was rejected
+// by the server (e.g. LOADING), is always retried. A command that failed after
+// the request was written is only retried if it is idempotent.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first one. Default is 3.
+	MaxAttempts int
+	// The backoff before the first retry. It doubles on every retry. Default is 8 milliseconds.
+	MinBackoff time.Duration
+	// The maximum backoff between two attempts. Default is 512 milliseconds.
+	MaxBackoff time.Duration
+	// Reports whether an error is transient. Default is IsRetryableError.
+	IsRetryable func(error) bool
+}
+
+func (r *RetryPolicy) check() {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if r.MinBackoff == 0 {
+		r.MinBackoff = defaultRetryMinBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if r.IsRetryable == nil {
+		r.IsRetryable = IsRetryableError
+	}
+}
+
+func (r *RetryPolicy) shouldRetry(cmd Command, err error, attempt int, written bool) bool {
+	if attempt >= r.MaxAttempts || !r.IsRetryable(err) {
+		return false
+	}
+	if !written {
+		return true
+	}
+	// A single command rejected by the server has not been executed. For a
+	// pipeline the commands before the rejected one may have been.
+	var e Error
+	if !isBatch(cmd) && errors.As(err, &e) {
+		return true
+	}
+	return isIdempotent(cmd)
+}
+
+// backoff returns the time to wait after the given attempt, using exponential
+// backoff with full jitter.
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	d := r.MinBackoff << uint(attempt-1)
+	if d > r.MaxBackoff || d <= 0 {
+		d = r.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func (r *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(r.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsRetryableError reports whether err is a transient failure: a network error
+// or a LOADING, TRYAGAIN, MASTERDOWN or CLUSTERDOWN error reply.
+func IsRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var e Error
+	if errors.As(err, &e) {
+		switch e.Type {
+		case "LOADING", "TRYAGAIN", "MASTERDOWN", "CLUSTERDOWN":
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// idempotentCommand is implemented by commands that can be sent again after
+// reaching the server without changing their outcome.
+type idempotentCommand interface {
+	Idempotent() bool
+}
+
+// idempotent is embedded in commands that are always safe to retry.
+type idempotent struct{}
+
+func (idempotent) Idempotent() bool {
+	return true
+}
+
+func isIdempotent(cmd Command) bool {
+	c, ok := cmd.(idempotentCommand)
+	return ok && c.Idempotent()
+}
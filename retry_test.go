@@ -0,0 +1,150 @@
+package godis
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRetryTestClient(ctr *gomock.Controller) (*client, *MockProtocol) {
+	mkCon := NewMockConnection(ctr)
+	mkCon.EXPECT().SetBroken().AnyTimes()
+	mkProtocol := NewMockProtocol(ctr)
+	mkPool := NewMockConnectionPool(ctr)
+	mkPool.EXPECT().GetConnection().Return(mkCon, nil).AnyTimes()
+	mkPool.EXPECT().Release(mkCon).Return(nil).AnyTimes()
+
+	config := &ClientConfig{Address: "1.1.1.1:6379", Retry: &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}}
+	_ = config.check()
+	c := newClient(config, mkPool)
+	c.newProtocol = func(_ Connection) Protocol {
+		return mkProtocol
+	}
+	return c, mkProtocol
+}
+
+func TestRetryBeforeWrite(t *testing.T) {
+	ctr := gomock.NewController(t)
+	defer ctr.Finish()
+
+	mkCon := NewMockConnection(ctr)
+	mkProtocol := NewMockProtocol(ctr)
+	mkPool := NewMockConnectionPool(ctr)
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: io.ErrUnexpectedEOF}
+	gomock.InOrder(
+		mkPool.EXPECT().GetConnection().Return(nil, dialErr),
+		mkPool.EXPECT().GetConnection().Return(mkCon, nil),
+	)
+	mkPool.EXPECT().Release(mkCon).Return(nil)
+
+	config := &ClientConfig{Address: "1.1.1.1:6379", Retry: &RetryPolicy{MinBackoff: time.Millisecond}}
+	assert.Nil(t, config.check())
+	c := newClient(config, mkPool)
+	c.newProtocol = func(_ Connection) Protocol {
+		return mkProtocol
+	}
+
+	ctx := context.Background()
+	mkProtocol.EXPECT().WriteBulkStringArray(ctx, stringsToBytes([]string{"INCR", "k"})).Return(nil)
+	mkProtocol.EXPECT().GetNextMsgType(ctx).Return(IntegerType, nil)
+	mkProtocol.EXPECT().ReadInteger(ctx).Return(int64(1), nil)
+
+	// INCR is not idempotent but nothing was written on the first attempt
+	r, err := c.Incr(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), r)
+}
+
+func TestRetryIdempotentAfterWrite(t *testing.T) {
+	ctr := gomock.NewController(t)
+	defer ctr.Finish()
+	c, mkProtocol := newRetryTestClient(ctr)
+
+	ctx := context.Background()
+	val := []byte("v")
+	mkProtocol.EXPECT().WriteBulkStringArray(ctx, stringsToBytes([]string{"GET", "k"})).Return(nil).Times(2)
+	gomock.InOrder(
+		mkProtocol.EXPECT().GetNextMsgType(ctx).Return(MsgType(0), io.EOF),
+		mkProtocol.EXPECT().GetNextMsgType(ctx).Return(BulkStringType, nil).Times(2),
+	)
+	mkProtocol.EXPECT().ReadBulkString(ctx).Return(&val, nil)
+
+	r, err := c.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *r)
+}
+
+func TestNoRetryNonIdempotentAfterWrite(t *testing.T) {
+	ctr := gomock.NewController(t)
+	defer ctr.Finish()
+	c, mkProtocol := newRetryTestClient(ctr)
+
+	ctx := context.Background()
+	mkProtocol.EXPECT().WriteBulkStringArray(ctx, stringsToBytes([]string{"INCR", "k"})).Return(nil).Times(1)
+	mkProtocol.EXPECT().GetNextMsgType(ctx).Return(MsgType(0), io.EOF).Times(1)
+
+	_, err := c.Incr(ctx, "k")
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestRetryRejectedCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	defer ctr.Finish()
+	c, mkProtocol := newRetryTestClient(ctr)
+
+	ctx := context.Background()
+	mkProtocol.EXPECT().WriteBulkStringArray(ctx, stringsToBytes([]string{"INCR", "k"})).Return(nil).Times(3)
+	mkProtocol.EXPECT().GetNextMsgType(ctx).Return(ErrorType, nil).Times(3)
+	mkProtocol.EXPECT().ReadError(ctx).Return(Error{Type: "LOADING", Msg: "Redis is loading the dataset in memory"}, nil).Times(3)
+
+	// Gives up after MaxAttempts
+	_, err := c.Incr(ctx, "k")
+	assert.Equal(t, "LOADING", err.(Error).Type)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, IsRetryableError(io.EOF))
+	assert.True(t, IsRetryableError(&net.OpError{Op: "read", Err: io.ErrUnexpectedEOF}))
+	assert.True(t, IsRetryableError(Error{Type: "TRYAGAIN"}))
+	assert.False(t, IsRetryableError(Error{Type: "ERR"}))
+	assert.False(t, IsRetryableError(context.DeadlineExceeded))
+	assert.False(t, IsRetryableError(ErrConnectionPoolFull))
+}
+
+func TestIdempotentCommands(t *testing.T) {
+	assert.True(t, isIdempotent(&stringGetCommand{}))
+	assert.False(t, isIdempotent(&stringIncrCommand{}))
+	assert.True(t, isIdempotent(&stringSetCommand{args: []arg{EXArg(1)}}))
+	assert.False(t, isIdempotent(&stringSetCommand{args: []arg{NXArg}}))
+	assert.True(t, isIdempotent(&Pipeline{commands: []Command{&stringGetCommand{}, &stringMSetCommand{}}}))
+	assert.False(t, isIdempotent(&Pipeline{commands: []Command{&stringGetCommand{}, &stringAppendCommand{}}}))
+}
+
+func TestRetryPipelineCanceledDuringBackoff(t *testing.T) {
+	server := newFakeServer(t, func(args []string) string {
+		return "-LOADING Redis is loading the dataset in memory\r\n"
+	})
+	cli, err := NewClient(&ClientConfig{
+		Address: server.Addr(),
+		Retry:   &RetryPolicy{MaxAttempts: 5, MinBackoff: time.Second},
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The results of the last attempt are returned when the backoff is
+	// cancelled
+	p := cli.Pipeline()
+	get := p.Get("k")
+	res, err := p.Exec(ctx)
+	var pe *PipelineError
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, []interface{}{nil}, res)
+	assert.Equal(t, "LOADING", get.Err().(Error).Type)
+}
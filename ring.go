@@ -0,0 +1,385 @@
+package godis
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRingHealthCheckInterval = time.Second
+	defaultRingFailureThreshold    = 3
+)
+
+type RingConfig struct {
+	// The settings of the connections to every shard. Address and Addresses
+	// are ignored.
+	ClientConfig
+	// The addresses of the shards by name. Keys are mapped to the names, so a
+	// shard can move to another address without moving its keys.
+	Shards map[string]string
+	// The interval between two PINGs of every shard. Default is 1 second.
+	HealthCheckInterval time.Duration
+	// The number of consecutive failed PINGs after which a shard is removed
+	// from the ring. Default is 3.
+	FailureThreshold int
+}
+
+func (c *RingConfig) check() error {
+	if len(c.Shards) == 0 {
+		return errors.Wrap(ErrGodis, "shards are empty")
+	}
+	var cfg *ClientConfig
+	for name, addr := range c.Shards {
+		cfg = c.ClientConfig.withAddress(addr)
+		if err := cfg.check(); err != nil {
+			return errors.Wrap(err, "invalid shard "+name)
+		}
+	}
+	c.ClientConfig = *cfg
+	c.Address = ""
+	if c.HealthCheckInterval == 0 {
+		c.HealthCheckInterval = defaultRingHealthCheckInterval
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaultRingFailureThreshold
+	}
+	return nil
+}
+
+// Ring shards keys over independent servers with rendezvous hashing: a key
+// goes to the live shard with the highest hash of the shard name and the key,
+// or of its hash tag, see hashTag. The shards are checked with PING in the
+// background; a failing shard is removed from the ring, moving its keys to
+// the other shards, and added back once it answers again.
+type Ring struct {
+	cmdable
+	config *RingConfig
+	nodes  *nodeRegistry
+	// Every shard, ordered by name.
+	shards []*ringShard
+
+	// []*ringShard, the live shards.
+	live atomic.Value
+}
+
+type ringShard struct {
+	name   string
+	addr   string
+	client *client
+	// The hash of the name, mixed with the hash of the keys.
+	seed uint64
+
+	// Only used by the health check.
+	failures int
+	down     bool
+}
+
+var _ Client = (*Ring)(nil)
+
+func NewRing(config *RingConfig) (*Ring, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	r := &Ring{config: config, nodes: newNodeRegistry(&config.ClientConfig)}
+	r.cmdable = r.exec
+	names := make([]string, 0, len(config.Shards))
+	for name := range config.Shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addr := config.Shards[name]
+		node, err := r.nodes.node(addr)
+		if err != nil {
+			return nil, err
+		}
+		r.shards = append(r.shards, &ringShard{
+			name:   name,
+			addr:   addr,
+			client: node,
+			seed:   hashString(name),
+		})
+	}
+	r.live.Store(r.shards)
+	r.nodes.run(r.healthCheckLoop)
+	return r, nil
+}
+
+func (r *Ring) Pipeline() *Pipeline {
+	return &Pipeline{exec: r.exec}
+}
+
+func (r *Ring) Conn(ctx context.Context) (*Conn, error) {
+	return nil, errors.Wrap(ErrGodis, "dedicated connections are not supported by the ring")
+}
+
+// Watch runs the transaction on the shard of keys, see (*client).Watch. The
+// keys must be in one shard.
+func (r *Ring) Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error {
+	if len(keys) == 0 {
+		return errors.Wrap(ErrGodis, "no key to watch")
+	}
+	shard, err := commandShard(r.liveShards(), &watchCommand{keys: keys})
+	if err != nil {
+		return errors.Wrap(err, "use a hash tag to put the watched keys in one shard")
+	}
+	return shard.client.Watch(ctx, fn, keys...)
+}
+
+// Close stops the health checks and closes the clients of every shard.
+func (r *Ring) Close() error {
+	return r.nodes.close(func(node *client) error {
+		return node.Close()
+	})
+}
+
+func (r *Ring) Shutdown(ctx context.Context) error {
+	return r.nodes.close(func(node *client) error {
+		return node.Shutdown(ctx)
+	})
+}
+
+func (r *Ring) liveShards() []*ringShard {
+	return r.live.Load().([]*ringShard)
+}
+
+// keyShard returns the shard of key among live.
+func keyShard(live []*ringShard, key string) *ringShard {
+	h := hashString(hashTag(key))
+	var best *ringShard
+	var bestScore uint64
+	for _, shard := range live {
+		if score := mixHash(shard.seed ^ h); best == nil || score > bestScore {
+			best, bestScore = shard, score
+		}
+	}
+	return best
+}
+
+// commandShard returns the shard of the keys of cmd, or a random shard if it
+// has no key.
+func commandShard(live []*ringShard, cmd Command) (*ringShard, error) {
+	if len(live) == 0 {
+		return nil, errors.Wrap(ErrGodis, "no live shard in the ring")
+	}
+	var shard *ringShard
+	for _, key := range commandKeys(cmd) {
+		s := keyShard(live, key)
+		if shard != nil && s != shard {
+			return nil, ErrCrossShard
+		}
+		shard = s
+	}
+	if shard == nil {
+		shard = live[rand.Intn(len(live))]
+	}
+	return shard, nil
+}
+
+func (r *Ring) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	if p, ok := cmd.(*Pipeline); ok {
+		return r.execPipeline(ctx, p)
+	}
+	shard, err := commandShard(r.liveShards(), cmd)
+	if errors.Is(err, ErrCrossShard) {
+		if m, ok := cmd.(multiKeyCommand); ok {
+			return r.execMultiKey(ctx, m)
+		}
+		return nil, errors.Wrap(err, "the command can't be split by shard, use a hash tag to put its keys in one shard")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return shard.client.exec(ctx, cmd)
+}
+
+// execMultiKey splits a multi-key command whose keys are in different shards
+// into one command per shard, sends them as a pipeline and merges their
+// results.
+func (r *Ring) execMultiKey(ctx context.Context, cmd multiKeyCommand) (interface{}, error) {
+	live := r.liveShards()
+	index := make(map[*ringShard]int, len(live))
+	for i, shard := range live {
+		index[shard] = i
+	}
+	keys := cmd.Keys()
+	groups := groupKeys(keys, func(key string) int {
+		return index[keyShard(live, key)]
+	})
+	p := &Pipeline{}
+	for _, indexes := range groups {
+		groupKeys := make([]string, 0, len(indexes))
+		for _, i := range indexes {
+			groupKeys = append(groupKeys, keys[i])
+		}
+		p.commands = append(p.commands, cmd.withKeys(groupKeys))
+	}
+	res, err := r.execPipeline(ctx, p)
+	var pe *PipelineError
+	if errors.As(err, &pe) {
+		return nil, pe.Unwrap()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cmd.merge(groups, res.([]interface{})), nil
+}
+
+// execPipeline splits the pipeline by shard and sends the parts in parallel.
+// The results are returned in the order of the commands.
+func (r *Ring) execPipeline(ctx context.Context, p *Pipeline) (interface{}, error) {
+	live := r.liveShards()
+	byShard := make(map[*ringShard][]int)
+	for i, cmd := range p.commands {
+		shard, err := commandShard(live, cmd)
+		if err != nil {
+			return nil, err
+		}
+		byShard[shard] = append(byShard[shard], i)
+	}
+
+	res := make([]interface{}, len(p.commands))
+	errs := make([]error, len(p.commands))
+	var wg sync.WaitGroup
+	for shard, indexes := range byShard {
+		wg.Add(1)
+		// Every command has its own index, so res and errs are written
+		// without lock.
+		go func(shard *ringShard, indexes []int) {
+			defer wg.Done()
+			b := &commandBatch{Pipeline: &Pipeline{}}
+			for _, i := range indexes {
+				b.commands = append(b.commands, p.commands[i])
+			}
+			if _, err := shard.client.execWithRetry(ctx, b); err != nil {
+				for _, i := range indexes {
+					errs[i] = err
+				}
+				return
+			}
+			for j, i := range indexes {
+				res[i], errs[i] = b.res[j], b.errs[j]
+			}
+		}(shard, indexes)
+	}
+	wg.Wait()
+
+	return pipelineResult(res, errs)
+}
+
+// ForEachShard calls fn concurrently with the client of every live shard,
+// e.g. to run FLUSHDB on the whole ring. The errors returned by fn are
+// gathered in a *ClusterError.
+func (r *Ring) ForEachShard(ctx context.Context, fn func(ctx context.Context, addr string, shard Client) error) error {
+	live := r.liveShards()
+	addrs := make([]string, 0, len(live))
+	for _, shard := range live {
+		addrs = append(addrs, shard.addr)
+	}
+	return r.nodes.forEach(ctx, addrs, fn)
+}
+
+// Scan is not supported by the ring since a cursor is only valid on one
+// shard, see ScanIterator or ForEachShard.
+func (r *Ring) Scan(ctx context.Context, cursor uint64, args ...arg) (ScanRes, error) {
+	return ScanRes{}, errors.Wrap(ErrGodis, "SCAN cursors are per shard in a ring, use ScanIterator")
+}
+
+// ScanIterator returns an iterator over the keys of every live shard, which
+// are scanned one after the other.
+func (r *Ring) ScanIterator(args ...arg) *ScanIterator {
+	it := &ScanIterator{args: args}
+	for _, shard := range r.liveShards() {
+		it.sources = append(it.sources, scanSource{addr: shard.addr, scan: shard.client.Scan})
+	}
+	return it
+}
+
+func (r *Ring) healthCheckLoop(ctx context.Context) {
+	ticker := time.NewTicker(r.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.healthCheck(ctx)
+	}
+}
+
+// healthCheck PINGs every shard and updates the live shards.
+func (r *Ring) healthCheck(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.HealthCheckInterval)
+	defer cancel()
+	failed := make([]bool, len(r.shards))
+	var wg sync.WaitGroup
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func(i int, shard *ringShard) {
+			defer wg.Done()
+			_, err := shard.client.execWithRetry(ctx, &doCommand{args: []string{"PING"}})
+			failed[i] = isShardFailure(err)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	changed := false
+	for i, shard := range r.shards {
+		if !failed[i] {
+			shard.failures = 0
+			if shard.down {
+				shard.down, changed = false, true
+				log.Println("ring shard " + shard.name + " is up")
+			}
+			continue
+		}
+		shard.failures++
+		if !shard.down && shard.failures >= r.config.FailureThreshold {
+			shard.down, changed = true, true
+			log.Println("ring shard " + shard.name + " is down")
+		}
+	}
+	if !changed {
+		return
+	}
+	var live []*ringShard
+	for _, shard := range r.shards {
+		if !shard.down {
+			live = append(live, shard)
+		}
+	}
+	r.live.Store(live)
+}
+
+// isShardFailure reports whether the PING of a shard failed. Unlike for
+// commands, a PING rejected by an open circuit breaker or a closed pool is a
+// failure: the shard can't serve the keys mapped to it.
+func isShardFailure(err error) bool {
+	return isNodeFailure(err) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrClosedPool)
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mixHash is the finalizer of SplitMix64, spreading the bits of the shard
+// seed and the key hash over the score.
+func mixHash(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
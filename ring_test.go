@@ -0,0 +1,131 @@
+package godis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	var mutex sync.Mutex
+	slow := false
+	keys := make(map[string][]string)
+	servers := make(map[string]*fakeServer)
+	shards := make(map[string]string)
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		kv := kvHandler()
+		servers[name] = newFakeServer(t, func(args []string) string {
+			mutex.Lock()
+			if name == "c" && slow {
+				mutex.Unlock()
+				time.Sleep(100 * time.Millisecond)
+				return "+PONG\r\n"
+			}
+			if strings.ToUpper(args[0]) == "SET" {
+				keys[name] = append(keys[name], args[1])
+			}
+			mutex.Unlock()
+			return kv(args)
+		})
+		shards[name] = servers[name].Addr()
+	}
+	ring, err := NewRing(&RingConfig{Shards: shards, HealthCheckInterval: 20 * time.Millisecond, FailureThreshold: 2})
+	assert.Nil(t, err)
+	defer ring.Close()
+	ctx := context.Background()
+
+	// Keys are spread over the shards and read back from them
+	for i := 0; i < 30; i++ {
+		_, err := ring.Set(ctx, "k"+strconv.Itoa(i), strconv.Itoa(i))
+		assert.Nil(t, err)
+	}
+	mutex.Lock()
+	for _, name := range []string{"a", "b", "c"} {
+		assert.NotEmpty(t, keys[name])
+	}
+	mutex.Unlock()
+	for i := 0; i < 30; i++ {
+		v, err := ring.Get(ctx, "k"+strconv.Itoa(i))
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), *v)
+	}
+	live := ring.liveShards()
+	assert.Equal(t, keyShard(live, "{user1}.name"), keyShard(live, "{user1}.email"))
+
+	// Multi-key commands and pipelines are split by shard
+	r, err := ring.MGet(ctx, "k1", "k2", "k3", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", *r[0])
+	assert.Equal(t, "3", *r[2])
+	assert.Nil(t, r[3])
+	p := ring.Pipeline()
+	for i := 0; i < 5; i++ {
+		p.Get("k" + strconv.Itoa(i))
+	}
+	res, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, strconv.Itoa(i), *res[i].(*string))
+	}
+	n, err := ring.Del(ctx, "k0", "k1", "k2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// A failing shard is removed and its keys go to the other shards, until
+	// it answers again
+	mutex.Lock()
+	slow = true
+	mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		return len(ring.liveShards()) == 2
+	}, time.Second, 10*time.Millisecond)
+	for _, shard := range ring.liveShards() {
+		assert.NotEqual(t, "c", shard.name)
+	}
+	mutex.Lock()
+	moved := keys["c"][0]
+	mutex.Unlock()
+	_, err = ring.Set(ctx, moved, "v")
+	assert.Nil(t, err)
+	v, err := ring.Get(ctx, moved)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+
+	mutex.Lock()
+	slow = false
+	mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		return len(ring.liveShards()) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	assert.ErrorIs(t, ring.Watch(ctx, func(tx *Conn) error { return nil }), ErrGodis)
+
+	_, err = NewRing(&RingConfig{})
+	assert.ErrorIs(t, err, ErrGodis)
+}
+
+func TestRingShardBehindOpenBreaker(t *testing.T) {
+	s := newFakeServer(t, kvHandler())
+	ring, err := NewRing(&RingConfig{
+		ClientConfig: ClientConfig{
+			CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute},
+		},
+		Shards:              map[string]string{"a": s.Addr(), "b": unreachableAddress(t)},
+		HealthCheckInterval: 20 * time.Millisecond,
+		FailureThreshold:    2,
+	})
+	assert.Nil(t, err)
+	defer ring.Close()
+
+	// The PINGs rejected by the open breaker count as failures
+	assert.Eventually(t, func() bool {
+		live := ring.liveShards()
+		return len(live) == 1 && live[0].name == "a"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,400 @@
+package godis
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sentinelRefreshTimeout = 10 * time.Second
+	sentinelReconnectDelay = time.Second
+)
+
+type FailoverConfig struct {
+	// The settings of the connections to the master, the replicas and the
+	// sentinels. Address and Addresses are ignored, the master is found through
+	// the sentinels.
+	ClientConfig
+	// The name of the master monitored by the sentinels.
+	MasterName string
+	// The addresses of the sentinels, queried in turn.
+	SentinelAddrs []string
+	// Send the read-only commands to a random replica instead of the master.
+	// Default is false.
+	ReplicaReads bool
+}
+
+func (c *FailoverConfig) check() error {
+	if c.MasterName == "" {
+		return errors.Wrap(ErrGodis, "master name is empty")
+	}
+	if len(c.SentinelAddrs) == 0 {
+		return errors.Wrap(ErrGodis, "sentinel addresses are empty")
+	}
+	cfg := c.ClientConfig.withAddress(c.SentinelAddrs[0])
+	if err := cfg.check(); err != nil {
+		return err
+	}
+	c.ClientConfig = *cfg
+	c.Address = ""
+	return nil
+}
+
+// FailoverClient is a client of a master monitored by Redis Sentinel. The
+// address of the master is asked to the sentinels, then the client follows
+// the +switch-master events published by them: the pool of the new master
+// replaces the one of the demoted node, whose connections are closed.
+type FailoverClient struct {
+	cmdable
+	config *FailoverConfig
+	// The clients of the master and the sentinels.
+	nodes *nodeRegistry
+	// The replicas serving reads, if ReplicaReads is set.
+	replicas *replicaSet
+
+	mutex      sync.Mutex
+	masterAddr string
+
+	refreshMutex sync.Mutex
+	refreshCh    chan struct{}
+}
+
+var _ Client = (*FailoverClient)(nil)
+
+func NewFailoverClient(config *FailoverConfig) (*FailoverClient, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	c := &FailoverClient{
+		config:    config,
+		nodes:     newNodeRegistry(&config.ClientConfig),
+		replicas:  newReplicaSet(ReplicaRandom, newNodeRegistry(&config.ClientConfig)),
+		refreshCh: make(chan struct{}, 1),
+	}
+	c.cmdable = c.exec
+	c.nodes.run(c.refreshLoop)
+	c.nodes.run(c.watch)
+	return c, nil
+}
+
+func (c *FailoverClient) Pipeline() *Pipeline {
+	return &Pipeline{exec: c.exec}
+}
+
+// Conn checks a connection to the master out of its pool.
+func (c *FailoverClient) Conn(ctx context.Context) (*Conn, error) {
+	node, err := c.node(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return node.Conn(ctx)
+}
+
+// Watch runs the transaction on the master, see (*client).Watch. The master
+// is looked up again before each attempt.
+func (c *FailoverClient) Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error {
+	return watch(ctx, c.Conn, &c.config.ClientConfig, fn, keys)
+}
+
+// Close stops watching the sentinels and closes the clients of the master,
+// the replicas and the sentinels.
+func (c *FailoverClient) Close() error {
+	return c.closeNodes(func(node *client) error {
+		return node.Close()
+	})
+}
+
+func (c *FailoverClient) Shutdown(ctx context.Context) error {
+	return c.closeNodes(func(node *client) error {
+		return node.Shutdown(ctx)
+	})
+}
+
+// closeNodes cancels the refresh in flight, then closes the clients.
+func (c *FailoverClient) closeNodes(closeNode func(*client) error) error {
+	err := c.nodes.close(closeNode)
+	if err1 := c.replicas.nodes.close(closeNode); err1 != nil && err == nil {
+		err = err1
+	}
+	return err
+}
+
+// node returns the client of the master, or of a random replica for the
+// read-only commands when ReplicaReads is set. The master is asked to the
+// sentinels on first use.
+func (c *FailoverClient) node(ctx context.Context, readOnly bool) (*client, error) {
+	if err := c.init(ctx); err != nil {
+		return nil, err
+	}
+	if readOnly {
+		if node := c.replicas.pick(); node != nil {
+			return node, nil
+		}
+	}
+	// Held while the client is looked up so that setMaster doesn't close it
+	// in between.
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.nodes.node(c.masterAddr)
+}
+
+func (c *FailoverClient) init(ctx context.Context) error {
+	if c.hasMaster() || c.nodes.isClosed() {
+		return nil
+	}
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	if c.hasMaster() || c.nodes.isClosed() {
+		return nil
+	}
+	return c.refreshLocked(ctx)
+}
+
+func (c *FailoverClient) hasMaster() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.masterAddr != ""
+}
+
+func (c *FailoverClient) exec(ctx context.Context, cmd Command) (interface{}, error) {
+	readOnly := isReadOnly(cmd)
+	for {
+		node, err := c.node(ctx, readOnly)
+		if err != nil {
+			return nil, err
+		}
+		res, err := node.exec(ctx, cmd)
+		if c.nodes.removed(err) || c.replicas.nodes.removed(err) {
+			continue
+		}
+		if isNodeFailure(err) || isReadOnlyError(err) {
+			c.triggerRefresh()
+		}
+		return res, err
+	}
+}
+
+// isReadOnlyError reports whether err is the reply of a replica to a write,
+// which means that the master was demoted.
+func isReadOnlyError(err error) bool {
+	var e Error
+	return errors.As(err, &e) && e.Type == "READONLY"
+}
+
+func (c *FailoverClient) triggerRefresh() {
+	select {
+	case c.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *FailoverClient) refreshLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.refreshCh:
+		}
+		refreshCtx, cancel := context.WithTimeout(ctx, sentinelRefreshTimeout)
+		if err := c.refresh(refreshCtx); err != nil && ctx.Err() == nil {
+			log.Println("failed to refresh the master from the sentinels: ", err)
+		}
+		cancel()
+	}
+}
+
+func (c *FailoverClient) refresh(ctx context.Context) error {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	return c.refreshLocked(ctx)
+}
+
+// refreshLocked asks the master, and the replicas if they serve reads, to
+// the first sentinel that knows them.
+func (c *FailoverClient) refreshLocked(ctx context.Context) error {
+	var lastErr error
+	for _, addr := range c.config.SentinelAddrs {
+		sentinel, err := c.nodes.node(addr)
+		if err != nil {
+			return err
+		}
+		master, err := getMasterAddr(ctx, sentinel, c.config.MasterName)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var replicas []string
+		if c.config.ReplicaReads {
+			replicas, err = getReplicaAddrs(ctx, sentinel, c.config.MasterName)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		c.setMaster(master)
+		c.setReplicas(replicas)
+		return nil
+	}
+	return errors.Wrap(lastErr, "failed to get master "+c.config.MasterName+" from the sentinels")
+}
+
+// setMaster replaces the client of the master if addr changed, the client of
+// the demoted node is closed.
+func (c *FailoverClient) setMaster(addr string) {
+	c.mutex.Lock()
+	oldAddr := c.masterAddr
+	c.masterAddr = addr
+	c.mutex.Unlock()
+
+	if oldAddr == "" || oldAddr == addr {
+		return
+	}
+	log.Println("master " + c.config.MasterName + " switched from " + oldAddr + " to " + addr)
+	c.nodes.remove(oldAddr)
+}
+
+// setReplicas replaces the replicas serving reads, keeping the clients of
+// the ones already known.
+func (c *FailoverClient) setReplicas(addrs []string) {
+	active := make([]replicaNode, 0, len(addrs))
+	for _, addr := range addrs {
+		node, err := c.replicas.node(addr)
+		if err != nil {
+			return
+		}
+		active = append(active, replicaNode{addr: addr, node: node})
+	}
+	c.replicas.set(active, addrs)
+}
+
+func getMasterAddr(ctx context.Context, sentinel *client, name string) (string, error) {
+	res, err := sentinel.execWithRetry(ctx, &doCommand{args: []string{"SENTINEL", "get-master-addr-by-name", name}})
+	if err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", errors.Wrap(ErrGodis, "master "+name+" is unknown to the sentinel")
+	}
+	// <ip> <port>
+	items, ok := res.([]interface{})
+	if !ok || len(items) != 2 {
+		return "", errors.WithStack(errUnexpectedRes)
+	}
+	return net.JoinHostPort(replyString(items[0]), replyString(items[1])), nil
+}
+
+// getReplicaAddrs returns the replicas of the master that are up, read from
+// the reply of SENTINEL REPLICAS, an array of replicas each given as
+// alternating field names and values.
+func getReplicaAddrs(ctx context.Context, sentinel *client, name string) ([]string, error) {
+	res, err := sentinel.execWithRetry(ctx, &doCommand{args: []string{"SENTINEL", "replicas", name}})
+	if err != nil {
+		return nil, err
+	}
+	items, ok := res.([]interface{})
+	if !ok {
+		return nil, errors.WithStack(errUnexpectedRes)
+	}
+	var addrs []string
+	for _, item := range items {
+		fields, ok := replyMap(item)
+		if !ok {
+			return nil, errors.WithStack(errUnexpectedRes)
+		}
+		if isReplicaDown(replyString(fields["flags"])) {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(replyString(fields["ip"]), replyString(fields["port"])))
+	}
+	return addrs, nil
+}
+
+func isReplicaDown(flags string) bool {
+	for _, flag := range strings.Split(flags, ",") {
+		switch flag {
+		case "s_down", "o_down", "disconnected":
+			return true
+		}
+	}
+	return false
+}
+
+// watch subscribes to the events of the sentinels, one after the other,
+// until the client is closed.
+func (c *FailoverClient) watch(ctx context.Context) {
+	for i := 0; ; i++ {
+		addr := c.config.SentinelAddrs[i%len(c.config.SentinelAddrs)]
+		if err := c.subscribe(ctx, addr); err != nil && ctx.Err() == nil {
+			log.Println("failed to watch sentinel "+addr+": ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sentinelReconnectDelay):
+		}
+	}
+}
+
+// subscribe reads the events of the sentinel at addr until the connection
+// fails or ctx is done.
+func (c *FailoverClient) subscribe(ctx context.Context, addr string) error {
+	config := c.config.withAddress(addr).toConPoolConfig().ConnectionConfig
+	con := NewConnection(&config)
+	if err := con.Connect(); err != nil {
+		return err
+	}
+	defer con.Close()
+	// The reads block without deadline, closing the connection ends them.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = con.Close()
+		case <-stop:
+		}
+	}()
+
+	protocol := NewProtocol(con)
+	if err := sendReq(ctx, protocol, []string{"SUBSCRIBE", "+switch-master", "+slave", "+sdown", "-sdown"}, nil); err != nil {
+		return err
+	}
+	// Catch up with the failovers missed while no sentinel was watched.
+	c.triggerRefresh()
+	for {
+		msg, err := protocol.ReadArray(ctx)
+		if err != nil {
+			return err
+		}
+		c.handleEvent(msg)
+	}
+}
+
+// handleEvent handles a message of the subscription, given as the "message"
+// kind, the channel and the payload.
+func (c *FailoverClient) handleEvent(msg []interface{}) {
+	if len(msg) != 3 || replyString(msg[0]) != "message" {
+		return
+	}
+	fields := strings.Fields(replyString(msg[2]))
+	switch replyString(msg[1]) {
+	case "+switch-master":
+		// <master name> <old ip> <old port> <new ip> <new port>
+		if len(fields) != 5 || fields[0] != c.config.MasterName {
+			return
+		}
+		c.setMaster(net.JoinHostPort(fields[3], fields[4]))
+		c.triggerRefresh()
+	default:
+		// <instance type> <name> <ip> <port> @ <master name> <master ip> <master port>
+		if len(fields) >= 6 && fields[4] == "@" && fields[5] == c.config.MasterName {
+			c.triggerRefresh()
+		}
+	}
+}
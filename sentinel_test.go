@@ -0,0 +1,162 @@
+package godis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSentinel serves the master and the replica it was given, and confirms
+// the subscriptions to its events.
+func fakeSentinel(t *testing.T, master, replica *string, mutex *sync.Mutex) *fakeServer {
+	return newFakeServer(t, func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch strings.ToUpper(args[0]) {
+		case "SENTINEL":
+			if args[2] != "mymaster" {
+				return "*-1\r\n"
+			}
+			switch strings.ToLower(args[1]) {
+			case "get-master-addr-by-name":
+				host, port, _ := net.SplitHostPort(*master)
+				return respArray(respBulk(host), respBulk(port))
+			case "replicas":
+				host, port, _ := net.SplitHostPort(*replica)
+				return respArray(respArray(
+					respBulk("ip"), respBulk(host),
+					respBulk("port"), respBulk(port),
+					respBulk("flags"), respBulk("slave"),
+				))
+			}
+		case "SUBSCRIBE":
+			var res string
+			for i, channel := range args[1:] {
+				res += respArray(respBulk("subscribe"), respBulk(channel), respInt(i+1))
+			}
+			return res
+		}
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	})
+}
+
+func TestFailoverClient(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string][]string)
+	node := func() *fakeServer {
+		kv := kvHandler()
+		var s *fakeServer
+		s = newFakeServer(t, func(args []string) string {
+			mutex.Lock()
+			requests[s.Addr()] = append(requests[s.Addr()], strings.Join(args, " "))
+			mutex.Unlock()
+			return kv(args)
+		})
+		return s
+	}
+	master, replica, promoted := node(), node(), node()
+	masterAddr, replicaAddr := master.Addr(), replica.Addr()
+	sentinel := fakeSentinel(t, &masterAddr, &replicaAddr, &mutex)
+
+	cli, err := NewFailoverClient(&FailoverConfig{
+		MasterName:    "mymaster",
+		SentinelAddrs: []string{unreachableAddress(t), sentinel.Addr()},
+		ReplicaReads:  true,
+	})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	// Writes go to the master and reads to the replica
+	_, err = cli.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	v, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	mutex.Lock()
+	assert.Equal(t, []string{"SET k v"}, requests[master.Addr()])
+	assert.Equal(t, []string{"GET k"}, requests[replica.Addr()])
+	mutex.Unlock()
+
+	// The client follows the failover announced by the sentinel, once it
+	// subscribed after failing to reach the first one.
+	assert.Eventually(t, func() bool {
+		return sentinel.OpenConNum() == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	mutex.Lock()
+	masterAddr = promoted.Addr()
+	mutex.Unlock()
+	oldHost, oldPort, _ := net.SplitHostPort(master.Addr())
+	newHost, newPort, _ := net.SplitHostPort(promoted.Addr())
+	sentinel.Publish("+switch-master", strings.Join([]string{"mymaster", oldHost, oldPort, newHost, newPort}, " "))
+	assert.Eventually(t, func() bool {
+		return master.OpenConNum() == 0
+	}, time.Second, 10*time.Millisecond)
+	_, err = cli.Set(ctx, "k", "v2")
+	assert.Nil(t, err)
+	mutex.Lock()
+	assert.Equal(t, []string{"SET k v2"}, requests[promoted.Addr()])
+	assert.Equal(t, []string{"SET k v"}, requests[master.Addr()])
+	mutex.Unlock()
+
+	// Without replica reads everything goes to the master
+	cli2, err := NewFailoverClient(&FailoverConfig{MasterName: "mymaster", SentinelAddrs: []string{sentinel.Addr()}})
+	assert.Nil(t, err)
+	defer cli2.Close()
+	v, err = cli2.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", *v)
+
+	_, err = NewFailoverClient(&FailoverConfig{SentinelAddrs: []string{sentinel.Addr()}})
+	assert.ErrorIs(t, err, ErrGodis)
+	cli3, err := NewFailoverClient(&FailoverConfig{MasterName: "other", SentinelAddrs: []string{sentinel.Addr()}})
+	assert.Nil(t, err)
+	defer cli3.Close()
+	_, err = cli3.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrGodis)
+}
+
+func TestFailoverClientCloseDuringRefresh(t *testing.T) {
+	// The sentinel confirms the subscription, which triggers a refresh, and
+	// never answers the refresh.
+	refreshing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	sentinel := newFakeServer(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "SUBSCRIBE" {
+			return respArray(respBulk("subscribe"), respBulk(args[1]), respInt(1))
+		}
+		select {
+		case refreshing <- struct{}{}:
+		default:
+		}
+		<-release
+		return "*-1\r\n"
+	})
+	t.Cleanup(func() { close(release) })
+
+	cli, err := NewFailoverClient(&FailoverConfig{
+		MasterName:    "mymaster",
+		SentinelAddrs: []string{sentinel.Addr()},
+	})
+	assert.Nil(t, err)
+	select {
+	case <-refreshing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no refresh")
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- cli.Close() }()
+	select {
+	case err := <-closed:
+		assert.Nil(t, err)
+	case <-time.After(sentinelRefreshTimeout / 2):
+		t.Fatal("Close waited for the refresh")
+	}
+}
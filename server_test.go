@@ -0,0 +1,206 @@
+package godis
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is a minimal RESP server for the tests that need a real socket.
+// Every request is passed to handler, which returns the raw reply.
+type fakeServer struct {
+	listener net.Listener
+	handler  func(args []string) string
+	mutex    sync.Mutex
+	conNum   int
+	// The open connections with the mutex of their writes, and the ones that
+	// sent SUBSCRIBE.
+	cons       map[net.Conn]*sync.Mutex
+	subscribed map[net.Conn]bool
+}
+
+func newFakeServer(t *testing.T, handler func(args []string) string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		listener:   l,
+		handler:    handler,
+		cons:       make(map[net.Conn]*sync.Mutex),
+		subscribed: make(map[net.Conn]bool),
+	}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) Close() {
+	_ = s.listener.Close()
+}
+
+func (s *fakeServer) ConNum() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.conNum
+}
+
+// OpenConNum returns the number of connections not closed by the client.
+func (s *fakeServer) OpenConNum() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.cons)
+}
+
+// Publish sends a pub/sub message to the connections that subscribed.
+func (s *fakeServer) Publish(channel, payload string) {
+	msg := "*3\r\n$7\r\nmessage\r\n" +
+		"$" + strconv.Itoa(len(channel)) + "\r\n" + channel + "\r\n" +
+		"$" + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n"
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for con := range s.subscribed {
+		s.cons[con].Lock()
+		_, _ = io.WriteString(con, msg)
+		s.cons[con].Unlock()
+	}
+}
+
+func (s *fakeServer) serve() {
+	for {
+		con, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conNum++
+		s.cons[con] = &sync.Mutex{}
+		s.mutex.Unlock()
+		go s.serveCon(con)
+	}
+}
+
+func (s *fakeServer) serveCon(con net.Conn) {
+	s.mutex.Lock()
+	writeMutex := s.cons[con]
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.cons, con)
+		delete(s.subscribed, con)
+		s.mutex.Unlock()
+		con.Close()
+	}()
+	r := bufio.NewReader(con)
+	for {
+		args, err := readFakeRequest(r)
+		if err != nil {
+			return
+		}
+		if strings.ToUpper(args[0]) == "SUBSCRIBE" {
+			s.mutex.Lock()
+			s.subscribed[con] = true
+			s.mutex.Unlock()
+		}
+		writeMutex.Lock()
+		_, err = io.WriteString(con, s.handler(args))
+		writeMutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readFakeRequest(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:l]))
+	}
+	return args, nil
+}
+
+// kvHandler serves the basic string and generic commands from a map.
+func kvHandler() func(args []string) string {
+	var mutex sync.Mutex
+	data := map[string]string{}
+	return func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			return "+PONG\r\n"
+		case "GET":
+			v, ok := data[args[1]]
+			if !ok {
+				return "$-1\r\n"
+			}
+			return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+		case "SET":
+			data[args[1]] = args[2]
+			return "+OK\r\n"
+		case "MGET":
+			res := "*" + strconv.Itoa(len(args)-1) + "\r\n"
+			for _, k := range args[1:] {
+				v, ok := data[k]
+				if !ok {
+					res += "$-1\r\n"
+					continue
+				}
+				res += "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			}
+			return res
+		case "MSET":
+			for i := 1; i+1 < len(args); i += 2 {
+				data[args[i]] = args[i+1]
+			}
+			return "+OK\r\n"
+		case "DEL", "UNLINK", "EXISTS", "TOUCH":
+			n := 0
+			for _, k := range args[1:] {
+				if _, ok := data[k]; ok {
+					n++
+					if args[0] == "DEL" || args[0] == "UNLINK" {
+						delete(data, k)
+					}
+				}
+			}
+			return ":" + strconv.Itoa(n) + "\r\n"
+		case "INCR":
+			n, _ := strconv.Atoi(data[args[1]])
+			n++
+			data[args[1]] = strconv.Itoa(n)
+			return ":" + strconv.Itoa(n) + "\r\n"
+		default:
+			return "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+	}
+}
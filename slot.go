@@ -0,0 +1,112 @@
+package godis
+
+import "strings"
+
+const clusterSlotNum = 16384
+
+var crc16Table = makeCrc16Table()
+
+// makeCrc16Table returns the table of CRC16-CCITT (XMODEM), the checksum used
+// by Redis Cluster to map keys to slots.
+func makeCrc16Table() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// hashSlot returns the cluster slot of key, see hashTag.
+func hashSlot(key string) int {
+	return int(crc16(hashTag(key)) % clusterSlotNum)
+}
+
+// hashTag returns the part of key that is hashed. If the key contains a
+// non-empty hash tag, i.e. a substring between the first '{' and the next
+// '}', only the tag is hashed so that related keys can be put in the same
+// slot.
+func hashTag(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+1+e]
+		}
+	}
+	return key
+}
+
+// keyedCommand is implemented by the commands that access keys, so that they
+// can be routed to the node serving the keys.
+type keyedCommand interface {
+	Keys() []string
+}
+
+func commandKeys(cmd Command) []string {
+	if c, ok := cmd.(keyedCommand); ok {
+		return c.Keys()
+	}
+	return nil
+}
+
+// multiKeyCommand is implemented by the multi-key commands that can be split
+// into one command per slot in cluster mode.
+type multiKeyCommand interface {
+	keyedCommand
+	// withKeys returns the same command for a subset of the keys.
+	withKeys(keys []string) Command
+	// merge combines the results of the commands returned by withKeys, given
+	// the indexes of their keys in Keys.
+	merge(indexes [][]int, results []interface{}) interface{}
+}
+
+// groupBySlot returns the indexes of keys grouped by slot, in the order of
+// the first key of each slot.
+func groupBySlot(keys []string) [][]int {
+	return groupKeys(keys, hashSlot)
+}
+
+// groupKeys returns the indexes of keys grouped by the value of group, in the
+// order of the first key of each group.
+func groupKeys(keys []string, group func(key string) int) [][]int {
+	var groups [][]int
+	byValue := make(map[int]int)
+	for i, key := range keys {
+		v := group(key)
+		g, ok := byValue[v]
+		if !ok {
+			g = len(groups)
+			byValue[v] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// commandSlot returns the slot of the keys of cmd, or -1 if it has no key.
+func commandSlot(cmd Command) (int, error) {
+	slot := -1
+	for _, key := range commandKeys(cmd) {
+		s := hashSlot(key)
+		if slot != -1 && s != slot {
+			return 0, ErrCrossSlot
+		}
+		slot = s
+	}
+	return slot, nil
+}
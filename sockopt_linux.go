@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package godis
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+func setKeepAliveProbes(con *net.TCPConn, interval time.Duration, count int) error {
+	raw, err := con.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if interval > 0 {
+			secs := int(interval / time.Second)
+			if secs < 1 {
+				secs = 1
+			}
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, secs)
+		}
+		if sockErr == nil && count > 0 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
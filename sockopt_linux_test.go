@@ -0,0 +1,58 @@
+//go:build linux
+// +build linux
+
+package godis
+
+import (
+	"bufio"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getSockOpt(t *testing.T, con net.Conn, level, opt int) int {
+	raw, err := con.(*net.TCPConn).SyscallConn()
+	assert.Nil(t, err)
+	var v int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		v, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, sockErr)
+	return v
+}
+
+func TestSocketOptions(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	con := &connection{config: &ConnectionConfig{
+		Address:           server.Addr(),
+		DialTimeOut:       time.Second,
+		KeepAlive:         30 * time.Second,
+		KeepAliveInterval: 7 * time.Second,
+		KeepAliveCount:    3,
+		DisableNoDelay:    true,
+	}}
+	assert.Nil(t, con.Connect())
+	defer con.Close()
+
+	assert.Equal(t, 1, getSockOpt(t, con.con, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE))
+	assert.Equal(t, 30, getSockOpt(t, con.con, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE))
+	assert.Equal(t, 7, getSockOpt(t, con.con, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL))
+	assert.Equal(t, 3, getSockOpt(t, con.con, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT))
+	assert.Equal(t, 0, getSockOpt(t, con.con, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+}
+
+func TestSocketOptionsBehindBufferedProxy(t *testing.T) {
+	server := newFakeServer(t, kvHandler())
+	raw, err := net.Dial("tcp", server.Addr())
+	assert.Nil(t, err)
+	defer raw.Close()
+
+	con := &connection{config: &ConnectionConfig{DisableNoDelay: true}}
+	assert.Nil(t, con.setSocketOptions(&bufferedConn{Conn: raw, r: bufio.NewReader(raw)}))
+	assert.Equal(t, 0, getSockOpt(t, raw, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package godis
+
+import (
+	"net"
+	"time"
+)
+
+// setKeepAliveProbes is a no-op, the probe settings are only supported on Linux.
+func setKeepAliveProbes(con *net.TCPConn, interval time.Duration, count int) error {
+	return nil
+}
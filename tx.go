@@ -0,0 +1,224 @@
+package godis
+
+import (
+	"context"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// TxPipeline returns a pipeline whose commands are sent in a MULTI/EXEC
+// transaction. In cluster mode or with a ring, the keys of the commands must
+// be in one slot or shard, see hashTag.
+func (c cmdable) TxPipeline() *Pipeline {
+	return &Pipeline{exec: c, tx: true}
+}
+
+// TxPipelined queues commands in a transaction with fn and executes it,
+// unless fn returns an error.
+func (c cmdable) TxPipelined(ctx context.Context, fn func(p *Pipeline) error) ([]interface{}, error) {
+	return txPipelined(ctx, c.TxPipeline(), fn)
+}
+
+func txPipelined(ctx context.Context, p *Pipeline, fn func(p *Pipeline) error) ([]interface{}, error) {
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	return p.Exec(ctx)
+}
+
+// Watch implements optimistic locking: it checks a connection out, WATCHes
+// keys on it and calls fn, which reads the keys with tx and writes them with
+// tx.TxPipelined. If a key is modified by another client before EXEC, the
+// transaction fails with ErrTxFailed, and fn is run again on a new WATCH up
+// to WatchRetries times.
+func (c *client) Watch(ctx context.Context, fn func(tx *Conn) error, keys ...string) error {
+	return watch(ctx, c.Conn, c.config, fn, keys)
+}
+
+// watch runs fn on a new WATCH of keys until its transaction succeeds, up to
+// WatchRetries times. The retries back off like the ones of Retry, or of the
+// default RetryPolicy.
+func watch(ctx context.Context, conn func(ctx context.Context) (*Conn, error), config *ClientConfig, fn func(tx *Conn) error, keys []string) error {
+	if len(keys) == 0 {
+		return errors.Wrap(ErrGodis, "no key to watch")
+	}
+	policy := config.Retry
+	if policy == nil {
+		policy = &RetryPolicy{}
+		policy.check()
+	}
+	for attempt := uint(0); ; attempt++ {
+		err := watchOnce(ctx, conn, fn, keys)
+		if !errors.Is(err, ErrTxFailed) || attempt >= config.WatchRetries || ctx.Err() != nil {
+			return err
+		}
+		if err := policy.wait(ctx, int(attempt)+1); err != nil {
+			return err
+		}
+	}
+}
+
+func watchOnce(ctx context.Context, conn func(ctx context.Context) (*Conn, error), fn func(tx *Conn) error, keys []string) error {
+	tx, err := conn(ctx)
+	if err != nil {
+		return err
+	}
+	// Closing the connection resets it, which unwatches the keys.
+	defer func() {
+		if err := tx.Close(); err != nil {
+			log.Println("failed to close watch connection: ", err)
+		}
+	}()
+	if _, err := tx.exec(ctx, &watchCommand{keys: keys}); err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+type watchCommand struct {
+	keys []string
+}
+
+func (c *watchCommand) Keys() []string {
+	return c.keys
+}
+
+func (c *watchCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	return sendReq(ctx, protocol, append([]string{"WATCH"}, c.keys...), nil)
+}
+
+func (c *watchCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	return readStatus(ctx, protocol, "OK")
+}
+
+// txCommand sends commands between MULTI and EXEC. An error reply to a
+// queued command, e.g. a syntax error, makes the server reject the whole
+// transaction with EXECABORT.
+type txCommand struct {
+	commands []Command
+}
+
+func (c *txCommand) Keys() []string {
+	var keys []string
+	for _, cmd := range c.commands {
+		keys = append(keys, commandKeys(cmd)...)
+	}
+	return keys
+}
+
+func (c *txCommand) Batch() bool {
+	return true
+}
+
+func (c *txCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	if err := sendReq(ctx, protocol, []string{"MULTI"}, nil); err != nil {
+		return err
+	}
+	for _, cmd := range c.commands {
+		if err := cmd.SendReq(ctx, protocol); err != nil {
+			return err
+		}
+	}
+	return sendReq(ctx, protocol, []string{"EXEC"}, nil)
+}
+
+// ReadResp reads the acknowledgements of MULTI and of the queued commands,
+// then the reply of EXEC. If the transaction was aborted, every command fails
+// with the error reply to it or with EXECABORT. A null reply to EXEC means
+// that a watched key was modified, see Watch.
+func (c *txCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	var e Error
+	multiErr := readAck(ctx, protocol, "OK")
+	if multiErr != nil && !errors.As(multiErr, &e) {
+		return nil, multiErr
+	}
+	errs := make([]error, len(c.commands))
+	for i := range c.commands {
+		err := readAck(ctx, protocol, "QUEUED")
+		if err != nil && !errors.As(err, &e) {
+			return nil, err
+		}
+		errs[i] = err
+	}
+
+	t, err := protocol.GetNextMsgType(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t == ErrorType {
+		execErr, err := protocol.ReadError(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if multiErr != nil {
+			return nil, multiErr
+		}
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = execErr
+			}
+		}
+		return pipelineResult(make([]interface{}, len(c.commands)), errs)
+	}
+	n, err := protocol.ReadArrayLen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n == -1 {
+		return nil, ErrTxFailed
+	}
+	if n != len(c.commands) {
+		return nil, errors.Wrap(errInvalidMsg, "unexpected number of EXEC replies")
+	}
+	res, errs, err := readResps(ctx, protocol, c.commands)
+	if err != nil {
+		return nil, err
+	}
+	return pipelineResult(res, errs)
+}
+
+// discardCommand opens a transaction and discards it, which unwatches the
+// keys WATCHed on the connection.
+type discardCommand struct{}
+
+func (c *discardCommand) Batch() bool {
+	return true
+}
+
+func (c *discardCommand) SendReq(ctx context.Context, protocol Protocol) error {
+	if err := sendReq(ctx, protocol, []string{"MULTI"}, nil); err != nil {
+		return err
+	}
+	return sendReq(ctx, protocol, []string{"DISCARD"}, nil)
+}
+
+func (c *discardCommand) ReadResp(ctx context.Context, protocol Protocol) (interface{}, error) {
+	multiErr := readAck(ctx, protocol, "OK")
+	var e Error
+	if multiErr != nil && !errors.As(multiErr, &e) {
+		return nil, multiErr
+	}
+	if err := readAck(ctx, protocol, "OK"); err != nil {
+		return nil, err
+	}
+	return nil, multiErr
+}
+
+// readAck reads the status reply to MULTI, DISCARD or a queued command, which
+// must be status. An error reply is returned as an Error.
+func readAck(ctx context.Context, protocol Protocol, status string) error {
+	t, err := protocol.GetNextMsgType(ctx)
+	if err != nil {
+		return err
+	}
+	if t == ErrorType {
+		e, err := protocol.ReadError(ctx)
+		if err != nil {
+			return err
+		}
+		return e
+	}
+	_, err = readStatus(ctx, protocol, status)
+	return err
+}
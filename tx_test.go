@@ -0,0 +1,208 @@
+package godis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// txHandler adds MULTI/EXEC and WATCH to kv, for one transaction at a time.
+// A SET outside of the transaction modifies the watched keys.
+func txHandler(kv func(args []string) string) func(args []string) string {
+	var mutex sync.Mutex
+	var queue [][]string
+	multi, aborted := false, false
+	watching, dirty := false, false
+	return func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch strings.ToUpper(args[0]) {
+		case "WATCH":
+			watching, dirty = true, false
+			return "+OK\r\n"
+		case "RESET":
+			watching, multi = false, false
+			return "+RESET\r\n"
+		case "DISCARD":
+			if !multi {
+				return "-ERR DISCARD without MULTI\r\n"
+			}
+			watching, multi, queue = false, false, nil
+			return "+OK\r\n"
+		case "SET":
+			if watching && !multi {
+				dirty = true
+			}
+		case "MULTI":
+			multi, aborted, queue = true, false, nil
+			return "+OK\r\n"
+		case "EXEC":
+			multi = false
+			if watching && dirty {
+				watching = false
+				return "*-1\r\n"
+			}
+			watching = false
+			if aborted {
+				return "-EXECABORT Transaction discarded because of previous errors.\r\n"
+			}
+			res := "*" + strconv.Itoa(len(queue)) + "\r\n"
+			for _, q := range queue {
+				res += kv(q)
+			}
+			return res
+		}
+		if !multi {
+			return kv(args)
+		}
+		if strings.ToUpper(args[0]) == "BAD" {
+			aborted = true
+			return "-ERR unknown command 'BAD'\r\n"
+		}
+		queue = append(queue, args)
+		return "+QUEUED\r\n"
+	}
+}
+
+// countDiscards counts the DISCARD requests handled by handler.
+func countDiscards(handler func(args []string) string, discards *int32) func(args []string) string {
+	return func(args []string) string {
+		if strings.ToUpper(args[0]) == "DISCARD" {
+			atomic.AddInt32(discards, 1)
+		}
+		return handler(args)
+	}
+}
+
+func TestTxPipeline(t *testing.T) {
+	var discards int32
+	server := newFakeServer(t, countDiscards(txHandler(kvHandler()), &discards))
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+
+	p := cli.TxPipeline()
+	set := p.Set("k", "v")
+	get := p.Get("k")
+	incr := p.Incr("k")
+	res, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, res, 3)
+	assert.True(t, set.Val())
+	assert.Equal(t, "v", *get.Val())
+	assert.Equal(t, int64(1), incr.Val())
+
+	_, err = cli.TxPipelined(ctx, func(p *Pipeline) error {
+		p.Set("k", "v2")
+		p.commands = append(p.commands, &doCommand{args: []string{"BAD"}})
+		p.results = append(p.results, &StatusCmd{})
+		return nil
+	})
+	var pe *PipelineError
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, "EXECABORT", pe.Errors[0].(Error).Type)
+	assert.Equal(t, "ERR", pe.Errors[1].(Error).Type)
+	v, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", *v)
+
+	p = cli.TxPipeline()
+	p.Set("k", "v3")
+	// Nothing is discarded on a pooled connection
+	assert.Nil(t, p.Discard(ctx))
+	assert.EqualValues(t, 0, atomic.LoadInt32(&discards))
+	res, err = p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, res)
+	v, err = cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", *v)
+}
+
+func TestWatch(t *testing.T) {
+	var discards int32
+	server := newFakeServer(t, countDiscards(txHandler(kvHandler()), &discards))
+	cli, err := NewClient(&ClientConfig{Address: server.Addr(), WatchRetries: 1})
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx := context.Background()
+	_, err = cli.Set(ctx, "n", "1")
+	assert.Nil(t, err)
+
+	attempts := 0
+	incr := func(tx *Conn) error {
+		attempts++
+		v, err := tx.Get(ctx, "n")
+		if err != nil {
+			return err
+		}
+		n, _ := strconv.Atoi(*v)
+		if attempts == 1 {
+			// Another client modifies the key
+			if _, err := cli.Set(ctx, "n", "10"); err != nil {
+				return err
+			}
+		}
+		_, err = tx.TxPipelined(ctx, func(p *Pipeline) error {
+			p.Set("n", strconv.Itoa(n+1))
+			return nil
+		})
+		return err
+	}
+	assert.Nil(t, cli.Watch(ctx, incr, "n"))
+	assert.Equal(t, 2, attempts)
+	v, err := cli.Get(ctx, "n")
+	assert.Nil(t, err)
+	assert.Equal(t, "11", *v)
+
+	// The connection of a failed transaction is reused
+	attempts = 0
+	conNum := server.ConNum()
+	cli.(*client).config.WatchRetries = 0
+	err = cli.Watch(ctx, incr, "n")
+	assert.ErrorIs(t, err, ErrTxFailed)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, conNum, server.ConNum())
+	v, err = cli.Get(ctx, "n")
+	assert.Nil(t, err)
+	assert.Equal(t, "10", *v)
+
+	assert.ErrorIs(t, cli.Watch(ctx, incr), ErrGodis)
+
+	// Discard aborts the transaction
+	err = cli.Watch(ctx, func(tx *Conn) error {
+		p := tx.TxPipeline()
+		p.Set("n", "20")
+		return p.Discard(ctx)
+	}, "n")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&discards))
+	v, err = cli.Get(ctx, "n")
+	assert.Nil(t, err)
+	assert.Equal(t, "10", *v)
+}
+
+func TestTxPipelineUnexpectedAck(t *testing.T) {
+	server := newFakeServer(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "MULTI" {
+			return "+OK\r\n"
+		}
+		return "+NOPE\r\n"
+	})
+	cli, err := NewClient(&ClientConfig{Address: server.Addr()})
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	_, err = cli.TxPipelined(context.Background(), func(p *Pipeline) error {
+		p.Set("k", "v")
+		return nil
+	})
+	assert.ErrorIs(t, err, errUnexpectedRes)
+}
@@ -0,0 +1,106 @@
+package godis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type UniversalConfig struct {
+	// The addresses are Address or Addresses, see NewUniversalClient. The
+	// other settings apply to the connections to every server.
+	ClientConfig
+	// The name of the master monitored by the sentinels, see FailoverConfig.
+	MasterName string
+	// See FailoverConfig.
+	ReplicaReads bool
+	// See ClusterConfig.
+	RefreshInterval time.Duration
+	// See ClusterConfig.
+	MaxRedirects int
+}
+
+// NewUniversalClient returns the client matching the topology of config:
+//   - a FailoverClient of the sentinels at the addresses if MasterName is set,
+//   - a ClusterClient seeded with the addresses if there are several,
+//   - a ClusterClient if the single server has cluster mode enabled, as
+//     reported by INFO cluster, or a standalone client otherwise.
+func NewUniversalClient(config *UniversalConfig) (Client, error) {
+	if config.MasterName != "" {
+		cli, err := NewFailoverClient(&FailoverConfig{
+			ClientConfig:  *config.withAddress(""),
+			MasterName:    config.MasterName,
+			SentinelAddrs: config.addrs(),
+			ReplicaReads:  config.ReplicaReads,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return cli, nil
+	}
+	if len(config.Addresses) > 1 {
+		return newUniversalCluster(config)
+	}
+
+	cfg := config.ClientConfig
+	if len(cfg.Addresses) == 1 {
+		cfg = *cfg.withAddress(cfg.Addresses[0])
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	cli := newClient(&cfg, cfg.newConnectionPool())
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DailTimeOut)
+	defer cancel()
+	enabled, err := clusterEnabled(ctx, cli)
+	if err != nil {
+		_ = cli.Close()
+		return nil, errors.Wrap(err, "failed to detect cluster mode")
+	}
+	if !enabled {
+		return cli, nil
+	}
+	_ = cli.Close()
+	return newUniversalCluster(config)
+}
+
+func newUniversalCluster(config *UniversalConfig) (Client, error) {
+	cli, err := NewClusterClient(&ClusterConfig{
+		ClientConfig:    config.ClientConfig,
+		RefreshInterval: config.RefreshInterval,
+		MaxRedirects:    config.MaxRedirects,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+func (c *UniversalConfig) addrs() []string {
+	if len(c.Addresses) > 0 {
+		return c.Addresses
+	}
+	return []string{c.Address}
+}
+
+// clusterEnabled reports whether the server has cluster mode enabled, read
+// from the cluster_enabled field of INFO cluster.
+func clusterEnabled(ctx context.Context, cli *client) (bool, error) {
+	res, err := cli.execWithRetry(ctx, &doCommand{args: []string{"INFO", "cluster"}})
+	if err != nil {
+		return false, err
+	}
+	info, ok := res.(*[]byte)
+	if !ok {
+		return false, errors.WithStack(errUnexpectedRes)
+	}
+	for _, line := range strings.Split(string(*info), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "cluster_enabled:") {
+			return strings.TrimPrefix(line, "cluster_enabled:") == "1", nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,56 @@
+package godis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniversalClient(t *testing.T) {
+	ctx := context.Background()
+	kv := kvHandler()
+	server := newFakeServer(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "INFO" {
+			return respBulk("# Cluster\r\ncluster_enabled:0\r\n")
+		}
+		return kv(args)
+	})
+	cli, err := NewUniversalClient(&UniversalConfig{ClientConfig: ClientConfig{Address: server.Addr()}})
+	assert.Nil(t, err)
+	assert.IsType(t, &client{}, cli)
+	_, err = cli.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	assert.Nil(t, cli.Close())
+
+	cluster := newFakeCluster(t, 2)
+	cli, err = NewUniversalClient(&UniversalConfig{ClientConfig: ClientConfig{Address: cluster.servers[0].Addr()}})
+	assert.Nil(t, err)
+	assert.IsType(t, &ClusterClient{}, cli)
+	_, err = cli.Set(ctx, "k", "v")
+	assert.Nil(t, err)
+	assert.Nil(t, cli.Close())
+
+	cli, err = NewUniversalClient(&UniversalConfig{ClientConfig: ClientConfig{
+		Addresses: []string{cluster.servers[0].Addr(), cluster.servers[1].Addr()},
+	}})
+	assert.Nil(t, err)
+	assert.IsType(t, &ClusterClient{}, cli)
+	assert.Nil(t, cli.Close())
+
+	var mutex sync.Mutex
+	masterAddr, replicaAddr := server.Addr(), server.Addr()
+	sentinel := fakeSentinel(t, &masterAddr, &replicaAddr, &mutex)
+	cli, err = NewUniversalClient(&UniversalConfig{ClientConfig: ClientConfig{Address: sentinel.Addr()}, MasterName: "mymaster"})
+	assert.Nil(t, err)
+	assert.IsType(t, &FailoverClient{}, cli)
+	v, err := cli.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", *v)
+	assert.Nil(t, cli.Close())
+
+	_, err = NewUniversalClient(&UniversalConfig{ClientConfig: ClientConfig{Address: unreachableAddress(t)}})
+	assert.NotNil(t, err)
+}